@@ -4,9 +4,11 @@ import (
 	"context"
 	"hawkeye/collector/agents"
 	"hawkeye/collector/aggregator"
+	"hawkeye/collector/raider"
 	"hawkeye/config"
 	"hawkeye/notifiers"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -19,24 +21,81 @@ func RunMetricMonitor() {
 	cfg := config.ReadConfig()
 	cfg.ValidateConnections()
 
-	monitors := aggregator.ReadMonitoringConfig(cfg.MonitorConfigFile, cfg.ServiceName)
+	agent := agents.NewRedisMonitoringAgent(cfg, NewMailingService(cfg))
+	monitors := aggregator.ReadMonitoringConfig(cfg.MonitorConfigFile, cfg.ServiceName, agent.NotifierNames()...)
 
-	agent := agents.NewRedisMonitoringAgent(cfg, notifiers.MockMailingService{})
 	go agent.Start(ctx, monitors...)
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	if cfg.AgentHTTPAddr != "" {
+		go serveStates(cfg.AgentHTTPAddr, agent)
+	}
 
-	for {
-		select {
-		case sig := <-c:
-			log.Println("received signal ", sig.String())
+	// a config which does not load keeps the monitors running as they are
+	reload := func() {
+		monitors, err := aggregator.LoadMonitoringConfig(cfg.MonitorConfigFile, cfg.ServiceName, agent.NotifierNames()...)
+		if err != nil {
+			log.Println("not reloading monitors, failed to read config ", err)
 			return
-		default:
 		}
+
+		agent.Reload(monitors...)
+	}
+
+	if err := agents.WatchConfigFile(ctx, cfg.MonitorConfigFile, reload); err != nil {
+		log.Println("not watching monitors config for changes ", err)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range c {
+		log.Println("received signal ", sig.String())
+
+		if sig == syscall.SIGHUP {
+			reload()
+			continue
+		}
+
+		return
+	}
+}
+
+// serveStates serves the alert states of the monitors of the agent, at /v1/states.
+func serveStates(addr string, agent agents.MonitoringAgent) {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/states", raider.StatesHandler(agent.States))
+
+	log.Println("serving alert states at", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("alert states listener stopped ", err)
 	}
 }
 
+// NewMailingService uses the notification service when it is configured, or else
+// sends the emails directly with smtp. Without either, the emails are only logged.
+func NewMailingService(cfg config.AppConfig) notifiers.MailingService {
+	if cfg.NotificationServiceURL != "" {
+		log.Println("sending emails with notification service")
+		return notifiers.NewNotificationService(cfg.NotificationServiceURL, cfg.NotificationServiceToken)
+	}
+
+	if cfg.SMTPHost != "" {
+		log.Println("sending emails with smtp through ", cfg.SMTPHost)
+		return notifiers.NewSMTPMailer(notifiers.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Auth:     cfg.SMTPAuth,
+			TLS:      cfg.SMTPTLS,
+			Sender:   cfg.SMTPSender,
+		})
+	}
+
+	log.Println("neither notification service nor smtp configured, emails will be logged")
+	return notifiers.MockMailingService{}
+}
+
 func main() {
 	log.SetFlags(log.Llongfile)
 	RunMetricMonitor()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"hawkeye/collector/raider"
 	"hawkeye/config"
 	"hawkeye/utils"
@@ -12,8 +13,16 @@ import (
 )
 
 func main() {
+	udpAddr := flag.String("udp", "", "address to listen for udp metrics, eg. 127.0.0.1:8125")
+	tcpAddr := flag.String("tcp", "", "address to listen for tcp metrics, eg. 127.0.0.1:8126")
+	httpAddr := flag.String("http", "", "address to serve the http api, eg. 127.0.0.1:8127")
+	flag.Parse()
+
 	cfg := config.AppConfig{
 		RedisHost: "localhost:6379",
+		UDPAddr:   *udpAddr,
+		TCPAddr:   *tcpAddr,
+		HTTPAddr:  *httpAddr,
 	}
 
 	cfg.ValidateConnections()
@@ -25,7 +34,12 @@ func main() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 
-	server := raider.NewMetricServer(cfg.RedisHost)
+	server := raider.NewMetricServer(
+		cfg.RedisHost,
+		raider.WithUDP(cfg.UDPAddr),
+		raider.WithTCP(cfg.TCPAddr),
+		raider.WithHTTP(cfg.HTTPAddr),
+	)
 	go server.Start(context.Background(), closing, done)
 
 	select {
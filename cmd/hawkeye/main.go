@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"hawkeye/collector/aggregator"
+	"os"
+)
+
+const usage = `usage: hawkeye <command> [arguments]
+
+commands:
+  lint [file ...]    validate the monitors config files, monitors.yaml by default
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "lint":
+		os.Exit(lint(flag.Args()[1:]...))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// lint prints the problems of every file, the exit code is 1 if any file is invalid.
+func lint(files ...string) int {
+	if len(files) == 0 {
+		files = []string{"monitors.yaml"}
+	}
+
+	code := 0
+
+	for _, file := range files {
+		monitors, err := aggregator.LoadMonitoringConfig(file, "")
+
+		var errs aggregator.ValidationErrors
+		switch {
+		case errors.As(err, &errs):
+			for _, verr := range errs {
+				fmt.Println(verr.Error())
+			}
+			code = 1
+		case err != nil:
+			fmt.Printf("%s: %v\n", file, err)
+			code = 1
+		default:
+			fmt.Printf("%s: ok, %d monitors\n", file, len(monitors))
+		}
+	}
+
+	return code
+}
@@ -54,7 +54,7 @@ func (mc MetricCollector) Process(ctx context.Context) {
 	defer ticker.Stop()
 
 	batchSize := 300
-	batch := make([]protocols.Metric, batchSize)
+	batch := make([]protocols.Metric, 0, batchSize)
 	for {
 		select {
 		case _metric, ok := <-mc.metricChan:
@@ -91,8 +91,18 @@ func (mc MetricCollector) ProcessBatch(ctx context.Context, metrics ...protocols
 			defer wg.Done()
 
 			var err error
-			if m.Type == protocols.MetricTypeCounter {
-				err = mc.repository.SetCount(ctx, m.Name, utils.Now().UnixMicro(), m.Value)
+			tags := quiver.Tags(m.TagList)
+			key := metricKey(m)
+
+			switch {
+			case m.Type == protocols.MetricTypeCounter:
+				err = mc.repository.SetCount(ctx, m.Name, tags, key, m.SampledValue())
+			case m.Type == protocols.MetricTypeGauge:
+				err = mc.repository.SetGauge(ctx, m.Name, tags, key, m.Value)
+			case m.Type == protocols.MetricTypeSet:
+				err = mc.repository.AddSetMember(ctx, m.Name, tags, key, m.Member)
+			case m.IsDistribution():
+				err = mc.repository.AddHistogram(ctx, m.Name, tags, key, m.Value)
 			}
 
 			if err != nil {
@@ -103,3 +113,13 @@ func (mc MetricCollector) ProcessBatch(ctx context.Context, metrics ...protocols
 
 	wg.Wait()
 }
+
+// metricKey is the timestamp the metric is stored at, in microseconds.
+// Metrics sent with a timestamp are stored at that time instead of now.
+func metricKey(m protocols.Metric) int64 {
+	if m.Timestamp > 0 {
+		return time.Unix(m.Timestamp, 0).UTC().UnixMicro()
+	}
+
+	return utils.Now().UnixMicro()
+}
@@ -0,0 +1,173 @@
+package agents
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// A monitor evaluated by more than one agent notifies more than once. With leader
+// election, the agents take a lease in redis, and only the holder of the lease runs
+// the monitors. The holder renews the lease, when it stops renewing the lease
+// expires, and one of the other agents takes over.
+
+const (
+	LeaseCacheKeyPrefix = "lease::"
+	DefaultLeaseTTL     = 15 * time.Second
+
+	// LeaderElectionAgent runs all the monitors in one agent, the leader.
+	LeaderElectionAgent = "agent"
+	// LeaderElectionMonitor elects a leader for every monitor, so the monitors are spread over the agents.
+	LeaderElectionMonitor = "monitor"
+)
+
+var (
+	renewLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Lease is held by a single owner until it is released, or it is not renewed within the ttl.
+type Lease struct {
+	client *redis.Client
+	key    string
+	owner  string
+	ttl    time.Duration
+}
+
+func NewLease(client *redis.Client, name string, ttl time.Duration) *Lease {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+
+	return &Lease{
+		client: client,
+		key:    LeaseCacheKeyPrefix + name,
+		owner:  leaseOwner(),
+		ttl:    ttl,
+	}
+}
+
+// leaseOwner is unique for every lease, even for two leases in the same agent.
+func leaseOwner() string {
+	host, _ := os.Hostname()
+
+	b := make([]byte, 6)
+	rand.Read(b)
+
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// Acquire takes the lease if nobody holds it.
+func (l *Lease) Acquire(ctx context.Context) (bool, error) {
+	return l.client.SetNX(ctx, l.key, l.owner, l.ttl).Result()
+}
+
+// Renew extends the lease for another ttl, it is false if the lease is not held anymore.
+func (l *Lease) Renew(ctx context.Context) (bool, error) {
+	renewed, err := renewLease.Run(ctx, l.client, []string{l.key}, l.owner, l.ttl.Milliseconds()).Int()
+	return renewed == 1, err
+}
+
+// Release gives the lease up, for another agent to take it without waiting for the ttl.
+func (l *Lease) Release(ctx context.Context) error {
+	return releaseLease.Run(ctx, l.client, []string{l.key}, l.owner).Err()
+}
+
+// RunAsLeader runs fn while it holds the lease, and keeps trying to take the lease
+// when it does not. The context of fn is cancelled once the lease is lost, and fn is
+// expected to return then. It returns when the context is done.
+func RunAsLeader(ctx context.Context, lease *Lease, fn func(ctx context.Context)) {
+	retry := lease.ttl / 3
+
+	for {
+		acquiredAt := time.Now()
+
+		acquired, err := lease.Acquire(ctx)
+		if err != nil {
+			log.Println("failed to acquire lease ", lease.key, err)
+		}
+
+		if acquired {
+			log.Println("acquired lease ", lease.key)
+			lead(ctx, lease, acquiredAt, fn)
+			log.Println("stopped leading ", lease.key)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// lead runs fn and renews the lease until fn returns, or the lease is lost. When the lease
+// cannot be renewed, it steps down before the lease expires, for fn to stop before another
+// agent takes the lease over.
+func lead(ctx context.Context, lease *Lease, acquiredAt time.Time, fn func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(lease.ttl / 3)
+	defer ticker.Stop()
+
+	// the lease runs from when it was asked for, not from the answer of redis
+	renewedAt := acquiredAt
+
+	for {
+		select {
+		case <-done:
+			// fn returned on its own, the lease is released for the others
+			if err := lease.Release(context.Background()); err != nil {
+				log.Println("failed to release lease ", lease.key, err)
+			}
+			return
+
+		case <-ticker.C:
+			at := time.Now()
+
+			// a renewal stuck on redis is a failed one, not one past the ttl
+			renewCtx, cancelRenew := context.WithTimeout(ctx, lease.ttl/3)
+			renewed, err := lease.Renew(renewCtx)
+			cancelRenew()
+
+			if err == nil && renewed {
+				renewedAt = at
+				continue
+			}
+
+			// without redis the lease could still be held, until the ttl is over. The renewal
+			// is tried once more, then it steps down a third of the ttl before the lease
+			// expires, for fn to stop in time.
+			if err != nil && time.Since(renewedAt) < lease.ttl/2 {
+				log.Println("failed to renew lease ", lease.key, err)
+				continue
+			}
+
+			cancel()
+			<-done
+			return
+		}
+	}
+}
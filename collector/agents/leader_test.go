@@ -0,0 +1,193 @@
+package agents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	return mr, client
+}
+
+func TestLeaseOwnership(t *testing.T) {
+	_, client := newRedis(t)
+	ctx := context.Background()
+
+	a := NewLease(client, "prod::checkout", time.Minute)
+	b := NewLease(client, "prod::checkout", time.Minute)
+
+	// a release does not tell if the lease was held, only a later acquire does
+	release := func(l *Lease) func(context.Context) (bool, error) {
+		return func(ctx context.Context) (bool, error) { return true, l.Release(ctx) }
+	}
+
+	steps := []struct {
+		name     string
+		do       func(context.Context) (bool, error)
+		expected bool
+	}{
+		{"a acquires", a.Acquire, true},
+		{"b acquires the held lease", b.Acquire, false},
+		{"b renews the lease of a", b.Renew, false},
+		{"b releases the lease of a", release(b), true},
+		{"b acquires after its release", b.Acquire, false},
+		{"a renews", a.Renew, true},
+		{"a releases", release(a), true},
+		{"a renews the released lease", a.Renew, false},
+		{"b acquires the released lease", b.Acquire, true},
+		{"a acquires the lease of b", a.Acquire, false},
+		{"b renews", b.Renew, true},
+	}
+
+	for _, s := range steps {
+		ok, err := s.do(ctx)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", s.name, err)
+		}
+
+		if ok != s.expected {
+			t.Errorf("%s: expected %v, got %v", s.name, s.expected, ok)
+		}
+	}
+}
+
+func TestLeaseExpires(t *testing.T) {
+	mr, client := newRedis(t)
+	ctx := context.Background()
+
+	a := NewLease(client, "prod::checkout", time.Minute)
+	b := NewLease(client, "prod::checkout", time.Minute)
+
+	if ok, _ := a.Acquire(ctx); !ok {
+		t.Fatalf("expected the lease to be acquired")
+	}
+
+	mr.FastForward(30 * time.Second)
+	if ok, _ := a.Renew(ctx); !ok {
+		t.Fatalf("expected the lease to be renewed")
+	}
+
+	// the renewal is for another ttl
+	mr.FastForward(45 * time.Second)
+	if ok, _ := b.Acquire(ctx); ok {
+		t.Errorf("expected the renewed lease to be held")
+	}
+
+	mr.FastForward(15 * time.Second)
+	if ok, _ := b.Acquire(ctx); !ok {
+		t.Errorf("expected the lease which was not renewed to be acquired")
+	}
+}
+
+// leading runs lead in the background, stopped is when fn returned and done when lead did.
+func leading(lease *Lease, fn func(ctx context.Context)) (stopped, done chan time.Time) {
+	stopped = make(chan time.Time, 1)
+	done = make(chan time.Time, 1)
+
+	go func() {
+		lead(context.Background(), lease, time.Now(), func(ctx context.Context) {
+			fn(ctx)
+			stopped <- time.Now()
+		})
+		done <- time.Now()
+	}()
+
+	return stopped, done
+}
+
+func TestLeadStepsDownWithoutRedis(t *testing.T) {
+	mr, client := newRedis(t)
+	ttl := 300 * time.Millisecond
+
+	lease := NewLease(client, "prod::checkout", ttl)
+	if ok, _ := lease.Acquire(context.Background()); !ok {
+		t.Fatalf("expected the lease to be acquired")
+	}
+	acquiredAt := time.Now()
+
+	mr.SetError("connection refused")
+
+	stopped, done := leading(lease, func(ctx context.Context) { <-ctx.Done() })
+
+	select {
+	case at := <-stopped:
+		// before the lease expires in redis, and another agent can take it
+		if at.Sub(acquiredAt) >= ttl {
+			t.Errorf("expected to step down before the ttl, stepped down after %v", at.Sub(acquiredAt))
+		}
+	case <-time.After(2 * ttl):
+		t.Fatalf("expected to step down without redis")
+	}
+
+	<-done
+}
+
+func TestLeadGoesOnWhileRenewing(t *testing.T) {
+	_, client := newRedis(t)
+	ttl := 150 * time.Millisecond
+
+	lease := NewLease(client, "prod::checkout", ttl)
+	if ok, _ := lease.Acquire(context.Background()); !ok {
+		t.Fatalf("expected the lease to be acquired")
+	}
+
+	stop := make(chan struct{})
+	stopped, done := leading(lease, func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+	})
+
+	select {
+	case <-stopped:
+		t.Fatalf("expected to lead while the lease is renewed")
+	case <-time.After(3 * ttl):
+	}
+
+	close(stop)
+	<-done
+
+	// fn returned on its own, the lease is released
+	other := NewLease(client, "prod::checkout", ttl)
+	if ok, _ := other.Acquire(context.Background()); !ok {
+		t.Errorf("expected the lease to be released")
+	}
+}
+
+func TestLeadStepsDownWhenTheLeaseIsLost(t *testing.T) {
+	mr, client := newRedis(t)
+	ttl := 150 * time.Millisecond
+
+	lease := NewLease(client, "prod::checkout", ttl)
+	if ok, _ := lease.Acquire(context.Background()); !ok {
+		t.Fatalf("expected the lease to be acquired")
+	}
+
+	// another agent holds the lease, as when it expired while this one was paused
+	mr.Set(lease.key, "other")
+
+	stopped, done := leading(lease, func(ctx context.Context) { <-ctx.Done() })
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * ttl):
+		t.Fatalf("expected to step down once the lease is lost")
+	}
+
+	<-done
+
+	if owner, _ := mr.Get(lease.key); owner != "other" {
+		t.Errorf("expected the lease of the other agent to be left, got %q", owner)
+	}
+}
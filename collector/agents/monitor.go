@@ -3,55 +3,207 @@ package agents
 import (
 	"context"
 	"errors"
+	"fmt"
 	"hawkeye/collector/aggregator"
 	"hawkeye/collector/monitors"
+	"hawkeye/collector/query"
 	"hawkeye/config"
 	"hawkeye/database"
 	"hawkeye/notifiers"
 	"hawkeye/protocols"
 	"hawkeye/quiver"
-	"hawkeye/utils"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/go-redis/redis/v8"
 )
 
 // this will take a list of Monitor and depending on metric type, it will start
 // <MetricType>Monitor. Example: CounterMonitor
 
 type MonitoringAgent struct {
-	cfg    config.AppConfig
-	mailer notifiers.MailingService
-	repo   quiver.Repository
+	cfg       config.AppConfig
+	mailer    notifiers.MailingService
+	repo      quiver.Repository
+	notifiers *notifiers.Registry
+	throttle  notifiers.ThrottleStore
+	running   *runningMonitors
+	set       *monitorSet
+	// client takes the leases, when leader election is enabled
+	client *redis.Client
 }
 
+// ThrottleRedis shares the notification throttle between the replicas of the agent.
+const ThrottleRedis = "redis"
+
 func NewRedisMonitoringAgent(cfg config.AppConfig, mailer notifiers.MailingService) MonitoringAgent {
-	repo := quiver.NewRedisRepo(database.NewRedisClient(cfg.RedisHost))
-	return MonitoringAgent{mailer: mailer, cfg: cfg, repo: repo}
+	client := database.NewRedisClient(cfg.RedisHost)
+
+	var throttle notifiers.ThrottleStore = notifiers.NewMemoryThrottleStore()
+	if cfg.NotifyThrottle == ThrottleRedis {
+		throttle = notifiers.NewRedisThrottleStore(client)
+	}
+
+	return MonitoringAgent{
+		mailer:    mailer,
+		cfg:       cfg,
+		repo:      quiver.NewRedisRepo(client),
+		notifiers: notifiers.DefaultRegistry(mailer),
+		throttle:  throttle,
+		running:   &runningMonitors{},
+		set:       &monitorSet{},
+		client:    client,
+	}
 }
 
-func (ma MonitoringAgent) Start(ctx context.Context, monitors ...aggregator.Monitor) {
-	dones := []chan error{}
+// runningMonitors has the started monitors, to query their states.
+type runningMonitors struct {
+	mu       sync.RWMutex
+	monitors []namedMonitor
+}
 
-	for _, monitor := range monitors {
-		if protocols.Is(monitor.Type, protocols.MetricTypeCounter) {
-			log.Println("setting up metric counter monitor for ", monitor.Metric)
+// namedMonitor is a started monitor, with the name composite monitors reference it by.
+type namedMonitor struct {
+	name    string
+	monitor startable
+}
 
-			done, err := ma.MonitorCounter(ctx, monitor)
-			if err != nil {
-				log.Println("could not start monitoring counters")
-				continue
-			}
-			dones = append(dones, done)
+func (r *runningMonitors) add(name string, m startable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.monitors = append(r.monitors, namedMonitor{name: name, monitor: m})
+}
+
+func (r *runningMonitors) remove(m startable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, running := range r.monitors {
+		if running.monitor == m {
+			r.monitors = append(r.monitors[:i], r.monitors[i+1:]...)
+			return
 		}
 	}
+}
 
-	for err := range utils.JoinErrors(dones...) {
-		if err != nil {
-			log.Println("monitor stopped ", err)
+// alerting is true when a group of a trigger of the named monitor is alerting.
+func (r *runningMonitors) alerting(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, running := range r.monitors {
+		if running.name != name {
+			continue
+		}
+
+		for _, state := range running.monitor.States() {
+			if state.State == notifiers.StateAlerting {
+				return true
+			}
 		}
 	}
 
+	return false
+}
+
+// States is the alert state of every group of every running monitor trigger.
+func (ma MonitoringAgent) States() []monitors.AlertState {
+	ma.running.mu.RLock()
+	defer ma.running.mu.RUnlock()
+
+	states := []monitors.AlertState{}
+	for _, m := range ma.running.monitors {
+		states = append(states, m.monitor.States()...)
+	}
+
+	return states
+}
+
+// WithNotifier registers a notifier, which monitors can then select with its name.
+func (ma MonitoringAgent) WithNotifier(name string, factory notifiers.NotifierFactory) MonitoringAgent {
+	ma.notifiers.Register(name, factory)
+	return ma
+}
+
+// NotifierNames are the notifiers registered with the agent, to validate the monitors config
+// against with aggregator.LoadMonitoringConfig.
+func (ma MonitoringAgent) NotifierNames() []string {
+	return ma.notifiers.Names()
+}
+
+// Start runs the monitors until the context is done. With leader election for the
+// agent, they run only while this agent holds the lease. The monitors can be
+// changed while running with Reload.
+func (ma MonitoringAgent) Start(ctx context.Context, monitors ...aggregator.Monitor) {
+	ma.set.want(monitors)
+
+	if ma.cfg.LeaderElection != LeaderElectionAgent {
+		ma.run(ctx)
+		return
+	}
+
+	RunAsLeader(ctx, ma.lease("agent"), ma.run)
+}
+
+// lease is the lease for the name, in the environment of the agent.
+func (ma MonitoringAgent) lease(name string) *Lease {
+	ttl := time.Duration(ma.cfg.LeaseTTLSeconds) * time.Second
+	return NewLease(ma.client, fmt.Sprintf("%s::%s::%s", ma.cfg.Environment, ma.cfg.ServiceName, name), ttl)
+}
+
+// run starts the monitors, and stops them once the context is done.
+func (ma MonitoringAgent) run(ctx context.Context) {
+	ma.set.run(ctx, ma.startMonitor)
+}
+
+var ErrUnsupportedMonitorType = errors.New("unsupported_monitor_type")
+
+// startMonitor starts the monitor of the metric type, the returned channel
+// receives ErrMonitoringStopped once it has stopped.
+func (ma MonitoringAgent) startMonitor(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	switch {
+	case monitor.Type == aggregator.MonitorTypeComposite:
+		log.Println("setting up composite monitor for ", monitor.Name)
+		return ma.MonitorComposite(ctx, monitor)
+
+	case monitor.Mode() == aggregator.TriggerAnomaly:
+		log.Println("setting up anomaly monitor for ", monitor.Metric)
+		return ma.MonitorAnomaly(ctx, monitor)
+
+	case monitor.Mode() == aggregator.TriggerCompare:
+		log.Println("setting up compare monitor for ", monitor.Metric)
+		return ma.MonitorCompare(ctx, monitor)
+
+	case monitor.Query != "":
+		log.Println("setting up query monitor for ", monitor.Query)
+		return ma.MonitorQuery(ctx, monitor)
+
+	case monitor.Expr != "":
+		log.Println("setting up ratio monitor for ", monitor.Expr)
+		return ma.MonitorRatio(ctx, monitor)
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeCounter):
+		log.Println("setting up metric counter monitor for ", monitor.Metric)
+		return ma.MonitorCounter(ctx, monitor)
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeGauge):
+		log.Println("setting up metric gauge monitor for ", monitor.Metric)
+		return ma.MonitorGauge(ctx, monitor)
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeHistogram),
+		protocols.Is(monitor.Type, protocols.MetricTypeTimer),
+		protocols.Is(monitor.Type, protocols.MetricTypeDistribution):
+		log.Println("setting up metric histogram monitor for ", monitor.Metric)
+		return ma.MonitorHistogram(ctx, monitor)
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeSet):
+		log.Println("setting up metric set monitor for ", monitor.Metric)
+		return ma.MonitorSet(ctx, monitor)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedMonitorType, monitor.Type)
 }
 
 const DefaultIntervalInSeconds time.Duration = 60
@@ -59,62 +211,313 @@ const DefaultIntervalInSeconds time.Duration = 60
 var ErrMonitoringStopped = errors.New("monitoring_stopped")
 
 func (ma MonitoringAgent) MonitorCounter(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
-	cfg := ma.cfg
+	log.Println("starting count metric monitor ", monitor.Metric)
+	// log.Printf("%+v\n", monitor)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewCountAggregator(ma.repo)))
+		return monitors.NewCounterMonitor(monitor.Metric, ma.cfg.Environment, opts...)
+	})
+}
+
+func (ma MonitoringAgent) MonitorGauge(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	if monitor.Aggregation != "" && !aggregator.IsGaugeAggregation(monitor.Aggregation) {
+		return nil, errors.New("unsupported_gauge_aggregation")
+	}
+
+	log.Println("starting gauge metric monitor ", monitor.Metric)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		agg := aggregator.NewGaugeAggregator(ma.repo, monitor.Aggregation)
+		opts = append(opts, monitors.WithAggregateFunc(agg))
+		return monitors.NewGaugeMonitor(monitor.Metric, ma.cfg.Environment, agg.Aggregation(), opts...)
+	})
+}
+
+func (ma MonitoringAgent) MonitorHistogram(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	if !aggregator.IsValidPercentile(monitor.Percentile) {
+		return nil, errors.New("invalid_percentile")
+	}
+
+	log.Println("starting histogram metric monitor ", monitor.Metric)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewPercentileAggregator(ma.repo, monitor.Percentile)))
+		return monitors.NewHistogramMonitor(monitor.Metric, ma.cfg.Environment, monitor.Percentile, opts...)
+	})
+}
+
+func (ma MonitoringAgent) MonitorSet(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	log.Println("starting set metric monitor ", monitor.Metric)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewUniqueAggregator(ma.repo)))
+		return monitors.NewCounterMonitor(monitor.Metric, ma.cfg.Environment, opts...)
+	})
+}
+
+// MonitorRatio monitors the ratio of the expr, grouped by the series of its denominator.
+func (ma MonitoringAgent) MonitorRatio(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	ratio, err := aggregator.ParseExpr(monitor.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("starting ratio monitor ", ratio)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewRatioAggregator(ma.repo, ratio, monitor.MinDenominator)))
+		return monitors.NewRatioMonitor(monitor.Metric, ma.cfg.Environment, opts...)
+	})
+}
+
+// MonitorQuery monitors the value of the query, grouped by the series of its first metric.
+func (ma MonitoringAgent) MonitorQuery(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	q, err := query.Parse(monitor.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("starting query monitor ", q)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewQueryAggregator(ma.repo, q)))
+		return monitors.NewQueryMonitor(monitor.Metric, ma.cfg.Environment, opts...)
+	})
+}
+
+// MonitorAnomaly monitors the deviation of the value of the monitor type from its baseline.
+func (ma MonitoringAgent) MonitorAnomaly(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	collector, err := ma.aggregatorOf(monitor)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := aggregator.BaselineConfig{}
+	if monitor.Baseline != nil {
+		baseline = *monitor.Baseline
+	}
+
+	log.Println("starting anomaly monitor ", monitor.Metric)
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewAnomalyAggregator(ma.repo, collector, baseline)))
+		return monitors.NewAnomalyMonitor(monitor.Metric, ma.cfg.Environment, opts...)
+	})
+}
+
+// MonitorCompare monitors the growth of the value of the monitor type, from the window offset earlier.
+func (ma MonitoringAgent) MonitorCompare(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	collector, err := ma.aggregatorOf(monitor)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, minPrevious := monitor.Triggers[0].Compare.Offset, monitor.Triggers[0].Compare.MinPrevious
+
+	log.Println("starting compare monitor ", monitor.Metric, " with ", offset, " ago")
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewCompareAggregator(collector, offset, minPrevious)))
+		return monitors.NewCompareMonitor(monitor.Metric, ma.cfg.Environment, offset, opts...)
+	})
+}
+
+// MonitorComposite monitors the condition over the states of the other monitors of the agent,
+// notifying once for the composite while it holds, rather than for each of them.
+func (ma MonitoringAgent) MonitorComposite(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	// with a lease per monitor, the monitors of the condition may run on another agent
+	if ma.cfg.LeaderElection == LeaderElectionMonitor {
+		return nil, errors.New("composite_monitor_with_monitor_leader_election")
+	}
+
+	condition, err := aggregator.ParseCondition(monitor.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("starting composite monitor ", monitor.Name, " of ", condition)
+
+	// the aggregator is 1 while the condition holds, the triggers are copied for the
+	// threshold not to change the monitor, which is compared on reload
+	triggers := make([]aggregator.Trigger, len(monitor.Triggers))
+	for i, trigger := range monitor.Triggers {
+		trigger.Threshold = 1
+		triggers[i] = trigger
+	}
+	monitor.Triggers = triggers
+
+	return ma.monitorTriggers(ctx, monitor, func(opts ...monitors.CounterMonitorOpts) startable {
+		opts = append(opts, monitors.WithAggregateFunc(aggregator.NewConditionAggregator(condition, ma.running.alerting)))
+		return monitors.NewCompositeMonitor(monitor.Name, ma.cfg.Environment, condition, opts...)
+	})
+}
+
+// aggregatorOf is the aggregator of the monitor type, or of its expr or query.
+func (ma MonitoringAgent) aggregatorOf(monitor aggregator.Monitor) (aggregator.RangeAggregator, error) {
+	switch {
+	case monitor.Query != "":
+		q, err := query.Parse(monitor.Query)
+		if err != nil {
+			return nil, err
+		}
+
+		return aggregator.NewQueryAggregator(ma.repo, q), nil
+
+	case monitor.Expr != "":
+		ratio, err := aggregator.ParseExpr(monitor.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return aggregator.NewRatioAggregator(ma.repo, ratio, monitor.MinDenominator), nil
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeCounter):
+		return aggregator.NewCountAggregator(ma.repo), nil
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeGauge):
+		if monitor.Aggregation != "" && !aggregator.IsGaugeAggregation(monitor.Aggregation) {
+			return nil, errors.New("unsupported_gauge_aggregation")
+		}
+
+		return aggregator.NewGaugeAggregator(ma.repo, monitor.Aggregation), nil
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeHistogram),
+		protocols.Is(monitor.Type, protocols.MetricTypeTimer),
+		protocols.Is(monitor.Type, protocols.MetricTypeDistribution):
+		if !aggregator.IsValidPercentile(monitor.Percentile) {
+			return nil, errors.New("invalid_percentile")
+		}
+
+		return aggregator.NewPercentileAggregator(ma.repo, monitor.Percentile), nil
+
+	case protocols.Is(monitor.Type, protocols.MetricTypeSet):
+		return aggregator.NewUniqueAggregator(ma.repo), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedMonitorType, monitor.Type)
+}
+
+type startable interface {
+	Start(ctx context.Context, w *sync.WaitGroup)
+	States() []monitors.AlertState
+}
 
+// monitorTriggers starts the monitor built by newMonitor, which checks all the triggers
+// on the value collected once per interval. The returned channel receives
+// ErrMonitoringStopped once it has stopped.
+func (ma MonitoringAgent) monitorTriggers(
+	ctx context.Context,
+	monitor aggregator.Monitor,
+	newMonitor func(opts ...monitors.CounterMonitorOpts) startable,
+) (chan error, error) {
 	if len(monitor.Triggers) == 0 {
 		return nil, errors.New("no_triggers_registered")
 	}
 
-	log.Println("starting count metric monitor ", monitor.Metric)
-	// log.Printf("%+v\n", monitor)
-
 	interval := time.Duration(monitor.IntervalInSeconds)
 	if interval == 0 {
 		interval = DefaultIntervalInSeconds
 	}
 	interval = interval * time.Second
 
-	done := make(chan error, 1)
+	// the groups are the ones of the series the monitor checks, the denominator of a ratio
+	// or the first metric of a query, rather than the expr or query itself
+	grouper := aggregator.NewTagGrouper(ma.repo, quiver.Tags(monitor.Tags), monitor.GroupBy)
 
-	var wg sync.WaitGroup
-	wg.Add(len(monitor.Triggers))
+	opts := []monitors.CounterMonitorOpts{
+		monitors.WithInterval(interval),
+		monitors.WithGrouper(aggregator.NewMetricGrouper(grouper, monitor.SeriesMetric())),
+	}
 
-	for _, trigger := range monitor.Triggers {
-		go func(t aggregator.Trigger) {
-			notifierCfg := notifiers.NotifierConfig{
-				ServiceName: cfg.ServiceName,
-				Environment: cfg.Environment,
-			}
+	if monitor.AbsentFor > 0 {
+		lastWrite := aggregator.NewMetricLastWriter(ma.repo, monitor.SeriesMetric())
+		opts = append(opts, monitors.WithAbsentFor(monitor.AbsentFor, lastWrite))
+	}
 
-			notifier := notifiers.NewEmailNotifier(
-				ma.mailer,
-				t,
-				notifierCfg,
-			)
-
-			opts := []monitors.CounterMonitorOpts{
-				monitors.WithThreshold(t.Threshold),
-				monitors.WithInterval(interval),
-				monitors.WithNotifier(notifier),
-				monitors.WithAggregateFunc(aggregator.NewCountAggregator(ma.repo)),
-			}
+	// the notifiers are built upfront, so a misconfigured trigger fails the whole monitor
+	for i, trigger := range monitor.Triggers {
+		if trigger.RecoverBelow != nil && *trigger.RecoverBelow > trigger.Limit() {
+			return nil, errors.New("recover_below_above_threshold")
+		}
 
-			cm := monitors.NewCounterMonitor(
-				monitor.Metric,
-				cfg.Environment,
-				opts...,
-			)
+		notifier, err := ma.triggerNotifier(monitor, i)
+		if err != nil {
+			return nil, err
+		}
 
-			cm.Start(ctx, &wg)
-		}(trigger)
+		opts = append(opts, monitors.WithTrigger(monitors.Trigger{
+			Severity:     trigger.Severity,
+			Threshold:    trigger.Limit(),
+			RecoverBelow: trigger.RecoverBelow,
+			PendingFor:   trigger.For,
+			Notifier:     notifier,
+		}))
 	}
 
-	go func() {
+	done := make(chan error, 1)
+
+	run := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		m := newMonitor(opts...)
+
+		ma.running.add(monitor.Name, m)
+		defer ma.running.remove(m)
+
+		m.Start(ctx, &wg)
 		wg.Wait()
-		log.Println("all monitors resolved ")
+	}
+
+	go func() {
+		// the monitor runs on the agent holding its lease, a new leader starts with fresh alert states.
+		// The lease is keyed by the ID, monitors of the same metric have their own leases
+		if ma.cfg.LeaderElection == LeaderElectionMonitor {
+			RunAsLeader(ctx, ma.lease("monitor::"+monitorID(monitor)), run)
+		} else {
+			run(ctx)
+		}
+
+		log.Println("monitor stopped ", monitor.Metric)
 		done <- ErrMonitoringStopped
 		close(done)
 	}()
 
 	return done, nil
 }
+
+// triggerNotifier notifies all the channels of the trigger, each throttled on its own run_every.
+func (ma MonitoringAgent) triggerNotifier(monitor aggregator.Monitor, trigger int) (notifiers.Notifier, error) {
+	t := monitor.Triggers[trigger]
+
+	channels := make(notifiers.MultiNotifier, 0, len(t.Channels))
+	for i, channel := range t.Channels {
+		notifierCfg := notifiers.NotifierConfig{
+			ServiceName: ma.cfg.ServiceName,
+			Environment: ma.cfg.Environment,
+			Monitor:     monitor.Metric,
+			MonitorID:   monitorID(monitor),
+			Trigger:     trigger,
+			Channel:     i,
+			Severity:    t.Severity,
+			Threshold:   t.Limit(),
+		}
+
+		notifier, err := ma.notifiers.New(monitor.ChannelOf(channel), notifierCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		// the notifications are only sent on transitions, the throttle is only needed to not
+		// repeat them, when the replicas of the agent share it, or with run_every
+		if channel.RunEveryMinute > 0 || ma.cfg.NotifyThrottle == ThrottleRedis {
+			throttleInterval := time.Duration(channel.RunEveryMinute) * time.Minute
+			notifier = notifiers.NewThrottledNotifier(notifier, ma.throttle, throttleInterval, notifierCfg)
+		}
+
+		channels = append(channels, notifier)
+	}
+
+	return channels, nil
+}
@@ -0,0 +1,184 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"hawkeye/collector/aggregator"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// monitorSet has the monitors the agent should run, and the ones it is running.
+type monitorSet struct {
+	mu sync.Mutex
+	// ctx is the context the monitors run with, nil when the agent is not running them
+	ctx     context.Context
+	wanted  map[string]aggregator.Monitor
+	running map[string]*runningMonitor
+}
+
+type runningMonitor struct {
+	monitor aggregator.Monitor
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+// monitorKeys keys the monitors by their name, or by the metric, type and tags.
+// Monitors with the same key are told apart by their position. The key is the ID of the monitor.
+func monitorKeys(monitors []aggregator.Monitor) map[string]aggregator.Monitor {
+	keyed := make(map[string]aggregator.Monitor, len(monitors))
+
+	for _, monitor := range monitors {
+		key := monitorKey(monitor)
+		for i := 2; ; i++ {
+			if _, ok := keyed[key]; !ok {
+				break
+			}
+			key = fmt.Sprintf("%s#%d", monitorKey(monitor), i)
+		}
+
+		monitor.ID = key
+		keyed[key] = monitor
+	}
+
+	return keyed
+}
+
+func monitorKey(monitor aggregator.Monitor) string {
+	// names are unique, and can not have a |
+	if monitor.Name != "" {
+		return monitor.Name
+	}
+
+	tags := make([]string, 0, len(monitor.Tags))
+	for k, v := range monitor.Tags {
+		tags = append(tags, k+":"+v)
+	}
+	sort.Strings(tags)
+
+	return fmt.Sprintf("%s|%s|%s", monitor.Metric, monitor.Type, strings.Join(tags, ","))
+}
+
+// monitorID is the ID of the monitor, or its key when it was not started from the monitor set.
+func monitorID(monitor aggregator.Monitor) string {
+	if monitor.ID != "" {
+		return monitor.ID
+	}
+
+	return monitorKey(monitor)
+}
+
+func (s *monitorSet) want(monitors []aggregator.Monitor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wanted = monitorKeys(monitors)
+}
+
+// startFunc starts the monitor, the returned channel receives ErrMonitoringStopped once it has stopped.
+type startFunc func(ctx context.Context, monitor aggregator.Monitor) (chan error, error)
+
+// Reload replaces the monitors of the agent. The monitors which are not in the
+// new ones are stopped, the new ones started, and the changed ones restarted.
+// The monitors which did not change keep running, with their alert states.
+func (ma MonitoringAgent) Reload(monitors ...aggregator.Monitor) {
+	ma.set.reload(monitors, ma.startMonitor)
+}
+
+func (s *monitorSet) reload(monitors []aggregator.Monitor, start startFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wanted = monitorKeys(monitors)
+
+	if s.ctx == nil {
+		log.Println("monitors will be started with the new config, once this agent is the leader")
+		return
+	}
+
+	s.apply(start)
+}
+
+// run starts the wanted monitors, and stops them once the context is done.
+func (s *monitorSet) run(ctx context.Context, start startFunc) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.apply(start)
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.running {
+		s.stop(key)
+	}
+	s.ctx = nil
+}
+
+// apply brings the running monitors in line with the wanted ones, the set is locked by the caller.
+func (s *monitorSet) apply(start startFunc) {
+	if s.running == nil {
+		s.running = map[string]*runningMonitor{}
+	}
+
+	var started, stopped, restarted, unchanged int
+
+	for key := range s.running {
+		if _, ok := s.wanted[key]; !ok {
+			log.Println("stopping removed monitor ", key)
+			s.stop(key)
+			stopped++
+		}
+	}
+
+	for key, monitor := range s.wanted {
+		running, ok := s.running[key]
+		if ok && reflect.DeepEqual(running.monitor, monitor) {
+			unchanged++
+			continue
+		}
+
+		if ok {
+			log.Println("restarting changed monitor ", key)
+			s.stop(key)
+		}
+
+		ctx, cancel := context.WithCancel(s.ctx)
+
+		done, err := start(ctx, monitor)
+		if err != nil {
+			log.Println("could not start monitor ", key, " ", err)
+			cancel()
+			continue
+		}
+
+		s.running[key] = &runningMonitor{monitor: monitor, cancel: cancel, done: done}
+
+		if ok {
+			restarted++
+		} else {
+			started++
+		}
+	}
+
+	log.Printf("monitors started %d, stopped %d, restarted %d, unchanged %d\n", started, stopped, restarted, unchanged)
+}
+
+// stop stops the monitor and waits for it to stop, the set is locked by the caller.
+func (s *monitorSet) stop(key string) {
+	running, ok := s.running[key]
+	if !ok {
+		return
+	}
+
+	running.cancel()
+	for range running.done {
+	}
+
+	delete(s.running, key)
+}
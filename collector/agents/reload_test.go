@@ -0,0 +1,255 @@
+package agents
+
+import (
+	"context"
+	"hawkeye/collector/aggregator"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// starter is a startMonitor stand-in, recording the IDs of the monitors started and
+// stopped. The monitors of fail are not started.
+type starter struct {
+	mu      sync.Mutex
+	started []string
+	stopped []string
+	fail    map[string]bool
+}
+
+func (s *starter) start(ctx context.Context, monitor aggregator.Monitor) (chan error, error) {
+	if s.fail[monitor.ID] {
+		return nil, ErrUnsupportedMonitorType
+	}
+
+	s.mu.Lock()
+	s.started = append(s.started, monitor.ID)
+	s.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		s.stopped = append(s.stopped, monitor.ID)
+		s.mu.Unlock()
+
+		done <- ErrMonitoringStopped
+		close(done)
+	}()
+
+	return done, nil
+}
+
+// calls returns the monitors started and stopped since the last calls, sorted.
+func (s *starter) calls() (started, stopped []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	started, stopped = s.started, s.stopped
+	s.started, s.stopped = nil, nil
+
+	sort.Strings(started)
+	sort.Strings(stopped)
+
+	return started, stopped
+}
+
+func counter(metric string, threshold float32, tags map[string]string) aggregator.Monitor {
+	return aggregator.Monitor{
+		Metric:   metric,
+		Type:     "counter",
+		Tags:     tags,
+		Triggers: []aggregator.Trigger{{Threshold: threshold}},
+	}
+}
+
+func TestMonitorKeys(t *testing.T) {
+	named := counter("http.response.500", 10, nil)
+	named.Name = "checkout_5xx"
+
+	keyed := monitorKeys([]aggregator.Monitor{
+		counter("http.request", 10, map[string]string{"route": "/pay", "method": "POST"}),
+		named,
+		counter("http.request", 10, nil),
+		counter("http.request", 20, nil),
+		counter("http.request", 30, nil),
+	})
+
+	expected := map[string]float32{
+		"http.request|counter|method:POST,route:/pay": 10,
+		"checkout_5xx":            10,
+		"http.request|counter|":   10,
+		"http.request|counter|#2": 20,
+		"http.request|counter|#3": 30,
+	}
+
+	if len(keyed) != len(expected) {
+		t.Fatalf("expected the keys %v, got %v", expected, keyed)
+	}
+
+	for key, threshold := range expected {
+		monitor, ok := keyed[key]
+		if !ok {
+			t.Errorf("expected the key %s, got %v", key, keyed)
+			continue
+		}
+
+		if monitor.ID != key {
+			t.Errorf("%s: expected the key to be the ID, got %s", key, monitor.ID)
+		}
+
+		if monitor.Triggers[0].Threshold != threshold {
+			t.Errorf("%s: expected the monitor of threshold %g, got %g", key, threshold, monitor.Triggers[0].Threshold)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	named := counter("http.response.500", 10, nil)
+	named.Name = "checkout_5xx"
+
+	changed := named
+	changed.Triggers = []aggregator.Trigger{{Threshold: 10, For: time.Minute}}
+
+	steps := []struct {
+		name     string
+		monitors []aggregator.Monitor
+		started  []string
+		stopped  []string
+	}{
+		{
+			name: "first load",
+			monitors: []aggregator.Monitor{
+				named, counter("cpu", 1, nil), counter("http.request", 10, nil), counter("http.request", 20, nil),
+			},
+			started: []string{"checkout_5xx", "cpu|counter|", "http.request|counter|", "http.request|counter|#2"},
+		},
+		{
+			name: "the same monitors",
+			monitors: []aggregator.Monitor{
+				named, counter("cpu", 1, nil), counter("http.request", 10, nil), counter("http.request", 20, nil),
+			},
+		},
+		{
+			name: "in another order",
+			monitors: []aggregator.Monitor{
+				counter("cpu", 1, nil), counter("http.request", 10, nil), named, counter("http.request", 20, nil),
+			},
+		},
+		{
+			name: "changed, removed and added",
+			monitors: []aggregator.Monitor{
+				changed, counter("cpu", 1, nil), counter("http.request", 10, nil), counter("memory", 1, nil),
+			},
+			started: []string{"checkout_5xx", "memory|counter|"},
+			stopped: []string{"checkout_5xx", "http.request|counter|#2"},
+		},
+		{
+			// the second of two monitors with the same key is keyed by its position
+			name: "a duplicate moved first",
+			monitors: []aggregator.Monitor{
+				changed, counter("cpu", 1, nil), counter("http.request", 20, nil), counter("http.request", 10, nil), counter("memory", 1, nil),
+			},
+			started: []string{"http.request|counter|", "http.request|counter|#2"},
+			stopped: []string{"http.request|counter|"},
+		},
+		{
+			name:    "all removed",
+			stopped: []string{"checkout_5xx", "cpu|counter|", "http.request|counter|", "http.request|counter|#2", "memory|counter|"},
+		},
+	}
+
+	st := &starter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	set := &monitorSet{ctx: ctx}
+
+	for _, s := range steps {
+		set.reload(s.monitors, st.start)
+
+		started, stopped := st.calls()
+		if !reflect.DeepEqual(started, s.started) {
+			t.Errorf("%s: expected %v to be started, got %v", s.name, s.started, started)
+		}
+
+		if !reflect.DeepEqual(stopped, s.stopped) {
+			t.Errorf("%s: expected %v to be stopped, got %v", s.name, s.stopped, stopped)
+		}
+
+		if len(set.running) != len(s.monitors) {
+			t.Errorf("%s: expected %d monitors running, got %d", s.name, len(s.monitors), len(set.running))
+		}
+	}
+}
+
+func TestReloadBeforeRunning(t *testing.T) {
+	st := &starter{}
+	set := &monitorSet{}
+
+	// the monitors are started once the agent runs them, as the leader
+	set.reload([]aggregator.Monitor{counter("cpu", 1, nil)}, st.start)
+	if started, _ := st.calls(); len(started) != 0 {
+		t.Fatalf("expected no monitor to be started, got %v", started)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		set.run(ctx, st.start)
+		close(done)
+	}()
+
+	deadline := time.After(time.Second)
+	for {
+		set.mu.Lock()
+		running := len(set.running)
+		set.mu.Unlock()
+
+		if running == 1 {
+			break
+		}
+
+		select {
+		case <-deadline:
+			t.Fatalf("expected the monitor to be started")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// once the agent is not the leader anymore, all the monitors are stopped
+	cancel()
+	<-done
+
+	started, stopped := st.calls()
+	if !reflect.DeepEqual(started, []string{"cpu|counter|"}) || !reflect.DeepEqual(stopped, []string{"cpu|counter|"}) {
+		t.Errorf("expected the monitor to be started and stopped, got %v and %v", started, stopped)
+	}
+
+	if len(set.running) != 0 {
+		t.Errorf("expected no monitor running, got %d", len(set.running))
+	}
+}
+
+func TestReloadStartFailure(t *testing.T) {
+	st := &starter{fail: map[string]bool{"memory|counter|": true}}
+	set := &monitorSet{ctx: context.Background()}
+
+	set.reload([]aggregator.Monitor{counter("cpu", 1, nil), counter("memory", 1, nil)}, st.start)
+
+	if _, ok := set.running["memory|counter|"]; ok {
+		t.Errorf("expected the monitor which failed to start not to be running")
+	}
+
+	// it is tried again on the next reload, the others keep running
+	st.fail = nil
+	set.reload([]aggregator.Monitor{counter("cpu", 1, nil), counter("memory", 1, nil)}, st.start)
+
+	started, stopped := st.calls()
+	if !reflect.DeepEqual(started, []string{"cpu|counter|", "memory|counter|"}) || len(stopped) != 0 {
+		t.Errorf("expected the monitor to be started on the next reload, got %v started and %v stopped", started, stopped)
+	}
+}
@@ -0,0 +1,66 @@
+package agents
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the events of a single save, editors write a file in more than one step.
+const reloadDebounce = 500 * time.Millisecond
+
+// WatchConfigFile calls onChange when the file changes, until the context is done.
+// The directory is watched instead of the file, so a file replaced by a rename,
+// or a kubernetes config map updated with a symlink swap, is still seen.
+func WatchConfigFile(ctx context.Context, file string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				name := filepath.Clean(event.Name)
+				if name == file || strings.HasPrefix(filepath.Base(name), "..") {
+					debounce = time.After(reloadDebounce)
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("config watcher error ", err)
+
+			case <-debounce:
+				debounce = nil
+				log.Println("config file changed ", file)
+				onChange()
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+	"time"
+)
+
+// LastWriter is when the series checked by a monitor were last written, for the
+// monitor to tell a value of 0 from series which are not reported anymore.
+type LastWriter interface {
+	LastWrite(ctx context.Context, tags quiver.Tags) (time.Time, error)
+}
+
+// MetricLastWriter is the last write of the series of the metric matching the tags.
+type MetricLastWriter struct {
+	repo   quiver.Repository
+	metric string
+}
+
+func NewMetricLastWriter(repo quiver.Repository, metric string) *MetricLastWriter {
+	return &MetricLastWriter{repo: repo, metric: metric}
+}
+
+func (m *MetricLastWriter) LastWrite(ctx context.Context, tags quiver.Tags) (time.Time, error) {
+	return m.repo.LastWrite(ctx, m.metric, tags)
+}
@@ -0,0 +1,70 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"hawkeye/quiver"
+	"testing"
+	"time"
+)
+
+func (f *fakeRepo) LastWrite(_ context.Context, metric string, filter quiver.Tags) (time.Time, error) {
+	f.reads = append(f.reads, metric)
+	f.filters = append(f.filters, filter)
+
+	return f.lastWrites[metric], f.err
+}
+
+func TestMetricLastWriter(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeRepo{lastWrites: map[string]time.Time{"http.request": at}}
+	group := quiver.Tags{"route": "/pay"}
+
+	// the series of a ratio are the ones of its denominator
+	w := NewMetricLastWriter(repo, "http.request")
+
+	written, err := w.LastWrite(context.Background(), group)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !written.Equal(at) {
+		t.Errorf("expected %v, got %v", at, written)
+	}
+
+	if len(repo.reads) != 1 || repo.reads[0] != "http.request" || repo.filters[0].String() != group.String() {
+		t.Errorf("expected http.request to be read for %s, got %v for %v", group, repo.reads, repo.filters)
+	}
+}
+
+func TestMetricLastWriterNeverWritten(t *testing.T) {
+	w := NewMetricLastWriter(&fakeRepo{}, "http.request")
+
+	written, err := w.LastWrite(context.Background(), nil)
+	if err != nil || !written.IsZero() {
+		t.Errorf("expected the zero time, got %v, %v", written, err)
+	}
+}
+
+func TestMetricLastWriterError(t *testing.T) {
+	repo := &fakeRepo{err: errors.New("connection refused")}
+
+	if _, err := NewMetricLastWriter(repo, "http.request").LastWrite(context.Background(), nil); !errors.Is(err, repo.err) {
+		t.Errorf("expected the error of the repository, got %v", err)
+	}
+}
+
+func TestSeriesMetric(t *testing.T) {
+	for _, tt := range []struct {
+		monitor Monitor
+		metric  string
+	}{
+		{Monitor{Metric: "http.request", Type: "c"}, "http.request"},
+		{Monitor{Metric: "errors", Expr: "ratio(http.response.500, http.request)"}, "http.request"},
+		{Monitor{Query: `sum(http.response.500[5m]) / sum(http.request[5m])`}, "http.response.500"},
+	} {
+		if metric := tt.monitor.SeriesMetric(); metric != tt.metric {
+			t.Errorf("%+v: expected %s, got %s", tt.monitor, tt.metric, metric)
+		}
+	}
+}
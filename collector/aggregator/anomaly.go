@@ -0,0 +1,103 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"math"
+	"time"
+)
+
+const (
+	DefaultBaselineAlpha  = 0.05
+	DefaultBaselineWarmup = 20
+
+	// SeasonalityWeekly keeps a baseline for every hour of the week, so the value
+	// is compared to the same hour of the previous weeks.
+	SeasonalityWeekly = "weekly"
+
+	// The seasonal baselines are updated once a week, with the mean of the hour,
+	// so alpha is the weight of the last week, and the warmup is in weeks.
+	DefaultSeasonalAlpha  = 0.3
+	DefaultSeasonalWarmup = 2
+)
+
+// AnomalyAggregator is how many standard deviations the value collected by the wrapped
+// aggregator is away from its baseline, in either direction. The baseline is kept in
+// quiver for every series and interval, and updated with every value collected.
+// Until the baseline has warmup values, the deviation is 0.
+//
+// A weekly seasonal baseline is kept for every hour of the week, and updated once per
+// period, the hour, with the mean of its values, when the same hour of the next week
+// starts. The values are compared to the previous weeks only, so an anomaly lasting
+// for the hour is not absorbed by the baseline, and the warmup is in periods.
+type AnomalyAggregator struct {
+	repo      quiver.Repository
+	collector Aggregator
+	cfg       BaselineConfig
+}
+
+func NewAnomalyAggregator(repo quiver.Repository, collector Aggregator, cfg BaselineConfig) *AnomalyAggregator {
+	seasonal := cfg.Seasonality == SeasonalityWeekly
+
+	if cfg.Alpha <= 0 {
+		cfg.Alpha = DefaultBaselineAlpha
+		if seasonal {
+			cfg.Alpha = DefaultSeasonalAlpha
+		}
+	}
+
+	if cfg.Warmup <= 0 {
+		cfg.Warmup = DefaultBaselineWarmup
+		if seasonal {
+			cfg.Warmup = DefaultSeasonalWarmup
+		}
+	}
+
+	return &AnomalyAggregator{repo: repo, collector: collector, cfg: cfg}
+}
+
+func (a *AnomalyAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	value, err := a.collector.Collect(ctx, metric, tags, interval)
+	if err != nil {
+		return 0, err
+	}
+
+	now := utils.Now()
+	key := a.key(metric, tags, interval, now)
+
+	baseline, err := a.repo.GetBaseline(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if a.cfg.Seasonality == SeasonalityWeekly {
+		// the baseline of the hour is folded in with the first value of the hour of the next week
+		baseline = baseline.AddToPeriod(float64(value), now.Truncate(time.Hour), a.cfg.Alpha, now)
+		if err := a.repo.SetBaseline(ctx, key, baseline); err != nil {
+			return 0, err
+		}
+	} else if err := a.repo.SetBaseline(ctx, key, baseline.Update(float64(value), a.cfg.Alpha, now)); err != nil {
+		return 0, err
+	}
+
+	if baseline.Count < a.cfg.Warmup {
+		return 0, nil
+	}
+
+	// a baseline which has not varied yet deviates by at least 1% of its mean, or min_stddev
+	minStddev := math.Max(a.cfg.MinStddev, math.Abs(baseline.Mean)/100)
+
+	return float32(math.Abs(baseline.ZScore(float64(value), minStddev))), nil
+}
+
+func (a *AnomalyAggregator) key(metric string, tags quiver.Tags, interval time.Duration, now time.Time) string {
+	key := fmt.Sprintf("%s::%s", quiver.SeriesKey(metric, tags), interval)
+
+	if a.cfg.Seasonality == SeasonalityWeekly {
+		key = fmt.Sprintf("%s::%s::%d", key, SeasonalityWeekly, int(now.Weekday())*24+now.Hour())
+	}
+
+	return key
+}
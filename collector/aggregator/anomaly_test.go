@@ -0,0 +1,95 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+	"math"
+	"testing"
+	"time"
+)
+
+func (f *fakeRepo) GetBaseline(_ context.Context, key string) (quiver.Baseline, error) {
+	return f.baselines[key], f.err
+}
+
+func (f *fakeRepo) SetBaseline(_ context.Context, key string, b quiver.Baseline) error {
+	if f.baselines == nil {
+		f.baselines = map[string]quiver.Baseline{}
+	}
+
+	f.baselines[key] = b
+	return f.err
+}
+
+func TestAnomalyAggregator(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    BaselineConfig
+		values []float32
+		sigmas []float32
+	}{
+		{
+			// the deviation is 0 until the baseline has warmup values, then measured against the earlier ones
+			name:   "warmup",
+			cfg:    BaselineConfig{Alpha: 0.5, Warmup: 3, MinStddev: 1},
+			values: []float32{6, 14, 12, 17},
+			// the baseline of 6, 14 and 12 has mean 11 and variance 0.5 * (16 + 2*1) = 9
+			sigmas: []float32{0, 0, 0, 2},
+		},
+		{
+			name:   "deviation in either direction",
+			cfg:    BaselineConfig{Alpha: 0.5, Warmup: 2, MinStddev: 1},
+			values: []float32{10, 20, 5},
+			// mean 15 and variance 25, 10 under the mean is 2 sigma
+			sigmas: []float32{0, 0, 2},
+		},
+		{
+			// a series which has not varied is 1% of its mean, or min_stddev, from it
+			name:   "min stddev",
+			cfg:    BaselineConfig{Alpha: 0.5, Warmup: 2, MinStddev: 4},
+			values: []float32{100, 100, 112},
+			sigmas: []float32{0, 0, 3},
+		},
+		{
+			name:   "one percent of the mean",
+			cfg:    BaselineConfig{Alpha: 0.5, Warmup: 2},
+			values: []float32{100, 100, 103},
+			sigmas: []float32{0, 0, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		repo := &fakeRepo{counts: map[string]float32{}}
+		a := NewAnomalyAggregator(repo, NewCountAggregator(repo), tt.cfg)
+
+		for i, value := range tt.values {
+			repo.counts["http.request"] = value
+
+			sigma, err := a.Collect(context.Background(), "http.request", nil, time.Minute)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tt.name, err)
+			}
+
+			if math.Abs(float64(sigma-tt.sigmas[i])) > 1e-4 {
+				t.Errorf("%s, value %d: expected %g sigma, got %g", tt.name, i, tt.sigmas[i], sigma)
+			}
+		}
+
+		baseline := repo.baselines[quiver.SeriesKey("http.request", nil)+"::1m0s"]
+		if baseline.Count != int64(len(tt.values)) {
+			t.Errorf("%s: expected the baseline to be updated with every value, got %+v", tt.name, baseline)
+		}
+	}
+}
+
+func TestAnomalyAggregatorDefaults(t *testing.T) {
+	a := NewAnomalyAggregator(&fakeRepo{}, nil, BaselineConfig{})
+	if a.cfg.Alpha != DefaultBaselineAlpha || a.cfg.Warmup != DefaultBaselineWarmup {
+		t.Errorf("expected the default alpha and warmup, got %+v", a.cfg)
+	}
+
+	seasonal := NewAnomalyAggregator(&fakeRepo{}, nil, BaselineConfig{Seasonality: SeasonalityWeekly})
+	if seasonal.cfg.Alpha != DefaultSeasonalAlpha || seasonal.cfg.Warmup != DefaultSeasonalWarmup {
+		t.Errorf("expected the seasonal alpha and warmup, got %+v", seasonal.cfg)
+	}
+}
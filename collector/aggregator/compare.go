@@ -0,0 +1,48 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"time"
+)
+
+// DefaultCompareMinPrevious is the least earlier value the value is compared to.
+const DefaultCompareMinPrevious = 1
+
+// CompareAggregator is how many times the value collected by the wrapped aggregator
+// is of the value of the same window, offset earlier. The earlier value is at least
+// minPrevious, so 1000 errors after none are 1000 times of them, and not 0.
+type CompareAggregator struct {
+	collector   RangeAggregator
+	offset      time.Duration
+	minPrevious float32
+}
+
+func NewCompareAggregator(collector RangeAggregator, offset time.Duration, minPrevious float32) *CompareAggregator {
+	if minPrevious <= 0 {
+		minPrevious = DefaultCompareMinPrevious
+	}
+
+	return &CompareAggregator{collector: collector, offset: offset, minPrevious: minPrevious}
+}
+
+func (c *CompareAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+
+	previous, err := c.collector.CollectBetween(ctx, metric, tags, now.Add(-c.offset-interval), now.Add(-c.offset))
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := c.collector.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+	if err != nil {
+		return 0, err
+	}
+
+	if previous < c.minPrevious {
+		previous = c.minPrevious
+	}
+
+	return current / previous, nil
+}
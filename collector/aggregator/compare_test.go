@@ -0,0 +1,83 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCompareAggregator(t *testing.T) {
+	tests := []struct {
+		name        string
+		previous    float32
+		current     float32
+		minPrevious float32
+		growth      float32
+	}{
+		{"growth", 10, 30, 0, 3},
+		{"drop", 40, 10, 0, 0.25},
+		{"nothing then and now", 0, 0, 0, 0},
+		// compared to at least 1 by default, the growth from none is the value
+		{"growth from none", 0, 1000, 0, 1000},
+		{"growth from under 1", 0.4, 10, 0, 10},
+		// a higher min previous keeps a few errors after none from firing
+		{"growth from none with min previous", 0, 30, 10, 3},
+		{"growth from under min previous", 4, 30, 10, 3},
+		{"growth from over min previous", 20, 30, 10, 1.5},
+	}
+
+	for _, tt := range tests {
+		repo := &fakeRepo{
+			counts:  map[string]float32{"http.response.500": tt.current},
+			earlier: map[string]float32{"http.response.500": tt.previous},
+			before:  time.Now().Add(-12 * time.Hour),
+		}
+
+		c := NewCompareAggregator(NewCountAggregator(repo), 24*time.Hour, tt.minPrevious)
+
+		growth, err := c.Collect(context.Background(), "http.response.500", nil, 10*time.Minute)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+
+		if math.Abs(float64(growth-tt.growth)) > 1e-6 {
+			t.Errorf("%s: expected %g, got %g", tt.name, tt.growth, growth)
+		}
+	}
+}
+
+func TestCompareAggregatorWindows(t *testing.T) {
+	repo := &fakeRepo{}
+	c := NewCompareAggregator(NewCountAggregator(repo), 24*time.Hour, 0)
+
+	if _, err := c.Collect(context.Background(), "http.response.500", nil, 10*time.Minute); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(repo.windows) != 2 {
+		t.Fatalf("expected the earlier and the current windows to be read, got %v", repo.windows)
+	}
+
+	previous, current := repo.windows[0], repo.windows[1]
+
+	// the same window, a day earlier
+	if current[1].Sub(current[0]) != 10*time.Minute || previous[1].Sub(previous[0]) != 10*time.Minute {
+		t.Errorf("expected windows of the interval, got %v and %v", previous, current)
+	}
+
+	if current[1].Sub(previous[1]) != 24*time.Hour {
+		t.Errorf("expected the earlier window to be offset by a day, got %v and %v", previous, current)
+	}
+}
+
+func TestCompareAggregatorError(t *testing.T) {
+	repo := &fakeRepo{err: errors.New("connection refused")}
+	c := NewCompareAggregator(NewCountAggregator(repo), 24*time.Hour, 0)
+
+	if _, err := c.Collect(context.Background(), "http.response.500", nil, 10*time.Minute); !errors.Is(err, repo.err) {
+		t.Errorf("expected the error of the repository, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hawkeye/quiver"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCondition = errors.New("invalid_condition")
+
+	conditionToken = regexp.MustCompile(`\(|\)|[A-Za-z0-9_\-]+`)
+	monitorName    = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// IsValidMonitorName is true for the names composites can reference, letters, digits, _ and -.
+func IsValidMonitorName(name string) bool {
+	return monitorName.MatchString(name) && !conditionKeywords[strings.ToLower(name)]
+}
+
+var conditionKeywords = map[string]bool{"and": true, "or": true, "not": true}
+
+// Condition is the boolean expression of a composite monitor, over the names of other monitors.
+type Condition interface {
+	// Eval is the value of the condition, alerting telling whether the named monitor is alerting.
+	Eval(alerting func(name string) bool) bool
+	// Names are the monitors the condition references.
+	Names() []string
+	String() string
+}
+
+// ParseCondition parses a condition of monitor names combined with and, or, not and parentheses,
+// like "checkout_5xx and (checkout_latency or not checkout_traffic)". Not binds the tightest, then and.
+func ParseCondition(condition string) (Condition, error) {
+	rest := conditionToken.ReplaceAllString(condition, "")
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidCondition, strings.TrimSpace(rest), condition)
+	}
+
+	p := &conditionParser{tokens: conditionToken.FindAllString(condition, -1)}
+
+	c, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v in %q", ErrInvalidCondition, err, condition)
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidCondition, p.tokens[p.pos], condition)
+	}
+
+	return c, nil
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return strings.ToLower(p.tokens[p.pos])
+}
+
+func (p *conditionParser) or() (Condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" {
+		p.pos++
+
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orCondition{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) and() (Condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" {
+		p.pos++
+
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andCondition{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) not() (Condition, error) {
+	switch token := p.peek(); {
+	case token == "":
+		return nil, errors.New("unexpected end")
+
+	case token == "not":
+		p.pos++
+
+		c, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		return notCondition{c}, nil
+
+	case token == "(":
+		p.pos++
+
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ")" {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+
+		return c, nil
+
+	case token == ")" || conditionKeywords[token]:
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	name := p.tokens[p.pos]
+	p.pos++
+
+	return nameCondition(name), nil
+}
+
+type nameCondition string
+
+func (n nameCondition) Eval(alerting func(string) bool) bool {
+	return alerting(string(n))
+}
+
+func (n nameCondition) Names() []string {
+	return []string{string(n)}
+}
+
+func (n nameCondition) String() string {
+	return string(n)
+}
+
+type notCondition struct {
+	c Condition
+}
+
+func (n notCondition) Eval(alerting func(string) bool) bool {
+	return !n.c.Eval(alerting)
+}
+
+func (n notCondition) Names() []string {
+	return n.c.Names()
+}
+
+func (n notCondition) String() string {
+	return "not " + n.c.String()
+}
+
+type andCondition struct {
+	left, right Condition
+}
+
+func (a andCondition) Eval(alerting func(string) bool) bool {
+	return a.left.Eval(alerting) && a.right.Eval(alerting)
+}
+
+func (a andCondition) Names() []string {
+	return append(a.left.Names(), a.right.Names()...)
+}
+
+func (a andCondition) String() string {
+	return "(" + a.left.String() + " and " + a.right.String() + ")"
+}
+
+type orCondition struct {
+	left, right Condition
+}
+
+func (o orCondition) Eval(alerting func(string) bool) bool {
+	return o.left.Eval(alerting) || o.right.Eval(alerting)
+}
+
+func (o orCondition) Names() []string {
+	return append(o.left.Names(), o.right.Names()...)
+}
+
+func (o orCondition) String() string {
+	return "(" + o.left.String() + " or " + o.right.String() + ")"
+}
+
+// ConditionAggregator is 1 while the condition of a composite monitor holds, and 0 otherwise.
+// The monitors it references are checked with alerting, on the states of the running monitors.
+type ConditionAggregator struct {
+	condition Condition
+	alerting  func(name string) bool
+}
+
+func NewConditionAggregator(condition Condition, alerting func(name string) bool) *ConditionAggregator {
+	return &ConditionAggregator{condition: condition, alerting: alerting}
+}
+
+func (c *ConditionAggregator) Collect(_ context.Context, _ string, _ quiver.Tags, _ time.Duration) (float32, error) {
+	if c.condition.Eval(c.alerting) {
+		return 1, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,118 @@
+package aggregator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		parsed    string
+		names     []string
+	}{
+		{"checkout_5xx", "checkout_5xx", []string{"checkout_5xx"}},
+		{"a and b", "(a and b)", []string{"a", "b"}},
+		{"a or b and c", "(a or (b and c))", []string{"a", "b", "c"}},
+		{"a and b or c", "((a and b) or c)", []string{"a", "b", "c"}},
+		{"(a or b) and c", "((a or b) and c)", []string{"a", "b", "c"}},
+		{"not a and b", "(not a and b)", []string{"a", "b"}},
+		{"not (a and b)", "not (a and b)", []string{"a", "b"}},
+		{"not not a", "not not a", []string{"a"}},
+		{"a AND NOT b Or c", "((a and not b) or c)", []string{"a", "b", "c"}},
+		{"checkout-latency and (checkout_5xx or not checkout_traffic)", "(checkout-latency and (checkout_5xx or not checkout_traffic))", []string{"checkout-latency", "checkout_5xx", "checkout_traffic"}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCondition(tt.condition)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.condition, err)
+			continue
+		}
+
+		if c.String() != tt.parsed {
+			t.Errorf("%s: expected %s, got %s", tt.condition, tt.parsed, c)
+		}
+
+		if !reflect.DeepEqual(c.Names(), tt.names) {
+			t.Errorf("%s: expected names %v, got %v", tt.condition, tt.names, c.Names())
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		condition string
+		msg       string
+	}{
+		{"", "unexpected end"},
+		{"a and", "unexpected end"},
+		{"a b", `unexpected "b"`},
+		{"and a", `unexpected "and"`},
+		{"a or or b", `unexpected "or"`},
+		{"(a and b", "missing )"},
+		{"a and b)", `unexpected ")"`},
+		{"()", `unexpected ")"`},
+		{"a && b", `unexpected "&&"`},
+		{"a.b", `unexpected "."`},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.condition)
+		if !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("%q: expected ErrInvalidCondition, got %v", tt.condition, err)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%q: expected the error to contain %q, got %q", tt.condition, tt.msg, err)
+		}
+	}
+}
+
+func TestConditionEval(t *testing.T) {
+	c, err := ParseCondition("errors and (latency or not traffic)")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		alerting []string
+		holds    bool
+	}{
+		{nil, false},
+		{[]string{"errors"}, true},
+		{[]string{"errors", "traffic"}, false},
+		{[]string{"errors", "traffic", "latency"}, true},
+		{[]string{"latency"}, false},
+	}
+
+	for _, tt := range tests {
+		alerting := map[string]bool{}
+		for _, name := range tt.alerting {
+			alerting[name] = true
+		}
+
+		if holds := c.Eval(func(name string) bool { return alerting[name] }); holds != tt.holds {
+			t.Errorf("%v alerting: expected %v, got %v", tt.alerting, tt.holds, holds)
+		}
+	}
+}
+
+func TestIsValidMonitorName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"checkout_5xx": true,
+		"p99-latency":  true,
+		"":             false,
+		"and":          false,
+		"NOT":          false,
+		"http.latency": false,
+		"a b":          false,
+	} {
+		if IsValidMonitorName(name) != valid {
+			t.Errorf("%q: expected valid to be %v", name, valid)
+		}
+	}
+}
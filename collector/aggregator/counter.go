@@ -3,12 +3,21 @@ package aggregator
 import (
 	"context"
 	"hawkeye/quiver"
+	"hawkeye/utils"
 	"math"
 	"time"
 )
 
+// Aggregator reduces the series of the metric matching the tags to a single value for the interval.
+// The error is the one of the repository, the value can not be told apart from no data then.
 type Aggregator interface {
-	Collect(ctx context.Context, metric string, interval time.Duration) float32
+	Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error)
+}
+
+// RangeAggregator can also reduce the series for an earlier window, from included to excluded.
+type RangeAggregator interface {
+	Aggregator
+	CollectBetween(ctx context.Context, metric string, tags quiver.Tags, from, to time.Time) (float32, error)
 }
 
 type CountAggregator struct {
@@ -19,7 +28,16 @@ func NewCountAggregator(repo quiver.Repository) *CountAggregator {
 	return &CountAggregator{repo: repo}
 }
 
-func (c *CountAggregator) Collect(ctx context.Context, metric string, interval time.Duration) float32 {
-	value := c.repo.GetCountRange(ctx, metric, interval)
-	return float32(math.Round(float64(value)))
+func (c *CountAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return c.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+}
+
+func (c *CountAggregator) CollectBetween(ctx context.Context, metric string, tags quiver.Tags, from, to time.Time) (float32, error) {
+	value, err := c.repo.GetCountBetween(ctx, metric, tags, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(math.Round(float64(value))), nil
 }
@@ -0,0 +1,84 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"time"
+)
+
+const (
+	GaugeLatest = "latest"
+	GaugeMin    = "min"
+	GaugeMax    = "max"
+	GaugeAvg    = "avg"
+)
+
+func IsGaugeAggregation(aggregation string) bool {
+	switch aggregation {
+	case GaugeLatest, GaugeMin, GaugeMax, GaugeAvg:
+		return true
+	}
+
+	return false
+}
+
+// GaugeAggregator reduces the gauge values reported in the
+// interval to a single value, depending on the aggregation.
+type GaugeAggregator struct {
+	repo        quiver.Repository
+	aggregation string
+}
+
+func NewGaugeAggregator(repo quiver.Repository, aggregation string) *GaugeAggregator {
+	if aggregation == "" {
+		aggregation = GaugeLatest
+	}
+
+	return &GaugeAggregator{repo: repo, aggregation: aggregation}
+}
+
+func (g *GaugeAggregator) Aggregation() string {
+	return g.aggregation
+}
+
+func (g *GaugeAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return g.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+}
+
+func (g *GaugeAggregator) CollectBetween(ctx context.Context, metric string, tags quiver.Tags, from, to time.Time) (float32, error) {
+	values, err := g.repo.GetGaugeBetween(ctx, metric, tags, from, to)
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+
+	switch g.aggregation {
+	case GaugeMin:
+		min := values[0]
+		for _, v := range values[1:] {
+			if v < min {
+				min = v
+			}
+		}
+		return min, nil
+
+	case GaugeMax:
+		max := values[0]
+		for _, v := range values[1:] {
+			if v > max {
+				max = v
+			}
+		}
+		return max, nil
+
+	case GaugeAvg:
+		var sum float64
+		for _, v := range values {
+			sum += float64(v)
+		}
+		return float32(sum / float64(len(values))), nil
+	}
+
+	return values[len(values)-1], nil
+}
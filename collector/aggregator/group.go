@@ -0,0 +1,80 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+)
+
+// Grouper splits the series of a metric into groups, each group is
+// the tag filter to collect the series of the group with. The groups
+// are not known when the series fail to be read, which is an error.
+type Grouper interface {
+	Groups(ctx context.Context, metric string) ([]quiver.Tags, error)
+}
+
+// TagGrouper groups the series matching the filter by the values of the group by tags.
+// Series which do not have all of the group by tags are left out.
+type TagGrouper struct {
+	repo    quiver.Repository
+	filter  quiver.Tags
+	groupBy []string
+}
+
+func NewTagGrouper(repo quiver.Repository, filter quiver.Tags, groupBy []string) *TagGrouper {
+	return &TagGrouper{repo: repo, filter: filter, groupBy: groupBy}
+}
+
+func (g *TagGrouper) Groups(ctx context.Context, metric string) ([]quiver.Tags, error) {
+	if len(g.groupBy) == 0 {
+		return []quiver.Tags{g.filter}, nil
+	}
+
+	all, err := g.repo.Series(ctx, metric, g.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	groups := []quiver.Tags{}
+
+	for _, series := range all {
+		group := quiver.Tags{}
+
+		for _, key := range g.groupBy {
+			value, ok := series[key]
+			if !ok {
+				break
+			}
+			group[key] = value
+		}
+
+		if len(group) != len(g.groupBy) {
+			continue
+		}
+
+		group = g.filter.Merge(group)
+		if seen[group.String()] {
+			continue
+		}
+
+		seen[group.String()] = true
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// MetricGrouper groups the series of another metric than the monitored one,
+// like the denominator of a ratio, which has the series the ratio is over.
+type MetricGrouper struct {
+	grouper Grouper
+	metric  string
+}
+
+func NewMetricGrouper(grouper Grouper, metric string) *MetricGrouper {
+	return &MetricGrouper{grouper: grouper, metric: metric}
+}
+
+func (g *MetricGrouper) Groups(ctx context.Context, _ string) ([]quiver.Tags, error) {
+	return g.grouper.Groups(ctx, g.metric)
+}
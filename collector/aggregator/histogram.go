@@ -0,0 +1,41 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"time"
+)
+
+// PercentileAggregator merges the histogram sketches stored for the
+// interval and returns the value at the percentile.
+type PercentileAggregator struct {
+	repo       quiver.Repository
+	percentile float64
+}
+
+func IsValidPercentile(percentile float64) bool {
+	return percentile > 0 && percentile <= 100
+}
+
+func NewPercentileAggregator(repo quiver.Repository, percentile float64) *PercentileAggregator {
+	return &PercentileAggregator{repo: repo, percentile: percentile}
+}
+
+func (p *PercentileAggregator) Percentile() float64 {
+	return p.percentile
+}
+
+func (p *PercentileAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return p.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+}
+
+func (p *PercentileAggregator) CollectBetween(ctx context.Context, metric string, tags quiver.Tags, from, to time.Time) (float32, error) {
+	sketch, err := p.repo.GetHistogramBetween(ctx, metric, tags, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(sketch.Quantile(p.percentile / 100)), nil
+}
@@ -2,56 +2,302 @@ package aggregator
 
 import (
 	"fmt"
+	"hawkeye/collector/query"
+	"hawkeye/protocols"
 	"hawkeye/utils"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Trigger struct {
-	Threshold      float32  `yaml:"threshold"`
-	Text           *string  `yaml:"text,omitempty"`
-	To             []string `yaml:"to"`
-	RunEveryMinute int64    `yaml:"run_every"`
-	Subject        string  `yaml:"subject"`
+	Threshold float32 `yaml:"threshold"`
+	// Severity is the level of the trigger, like warn or critical, only in version 2.
+	Severity string `yaml:"severity,omitempty"`
+	// For is how long the threshold has to be breached, on consecutive checks, before it alerts.
+	For time.Duration `yaml:"for,omitempty"`
+	// RecoverBelow is the value the alert resolves under, defaults to the threshold.
+	// Keeping it lower than the threshold stops a value around the threshold from flapping.
+	RecoverBelow *float32 `yaml:"recover_below,omitempty"`
+	// Anomaly triggers on the deviation from the baseline of the monitor, instead of the threshold.
+	Anomaly *AnomalyConfig `yaml:"anomaly,omitempty"`
+	// Compare triggers on the growth from the same window, offset earlier, instead of the threshold.
+	Compare *CompareConfig `yaml:"compare,omitempty"`
+	// Channels are notified when the trigger alerts or resolves, only in version 2.
+	// Version 1 triggers are converted on load, to a single channel of their own notifier fields.
+	Channels []Channel `yaml:"channels,omitempty"`
+
+	// The notifier of a version 1 trigger, converted to its only channel.
+	Text *string  `yaml:"text,omitempty"`
+	To   []string `yaml:"to,omitempty"`
+	// RunEveryMinute is the least minutes between two notifications of the same alert.
+	RunEveryMinute int64            `yaml:"run_every,omitempty"`
+	Subject        string           `yaml:"subject,omitempty"`
+	Notifier       string           `yaml:"notifier,omitempty"`
+	Slack          *SlackConfig     `yaml:"slack,omitempty"`
+	Webhook        *WebhookConfig   `yaml:"webhook,omitempty"`
+	PagerDuty      *PagerDutyConfig `yaml:"pagerduty,omitempty"`
+}
+
+// AnomalyConfig triggers when the value is sigma standard deviations away from the baseline.
+type AnomalyConfig struct {
+	Sigma float32 `yaml:"sigma"`
+}
+
+// CompareConfig triggers when the value is factor times the one of the window offset earlier,
+// like 3 times the errors of the same 10 minutes a day ago. The earlier value is at least
+// MinPrevious, 1 by default, so that errors growing from none can trigger.
+type CompareConfig struct {
+	Offset      time.Duration `yaml:"offset"`
+	Factor      float32       `yaml:"factor"`
+	MinPrevious float32       `yaml:"min_previous,omitempty"`
+}
+
+// The modes of the triggers, the triggers of a monitor all have the same mode.
+const (
+	TriggerThreshold = "threshold"
+	TriggerAnomaly   = "anomaly"
+	TriggerCompare   = "compare"
+)
+
+// BaselineConfig is how the baseline of the anomaly triggers is kept. Alpha is the weight
+// of every new value in the moving average, and warmup the values needed before it is used.
+// With a weekly seasonality, the values are the means of the hours, one per week.
+type BaselineConfig struct {
+	Alpha       float64 `yaml:"alpha,omitempty"`
+	Warmup      int64   `yaml:"warmup,omitempty"`
+	Seasonality string  `yaml:"seasonality,omitempty"`
+	// MinStddev is the least deviation of the baseline, for the series which have not varied yet.
+	MinStddev float64 `yaml:"min_stddev,omitempty"`
+}
+
+// Channel is a notifier of a trigger, with its own recipients, text and throttle.
+type Channel struct {
+	Notifier string   `yaml:"notifier,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+	Text     *string  `yaml:"text,omitempty"`
+	Subject  string   `yaml:"subject,omitempty"`
+	// RunEveryMinute is the least minutes between two notifications of the same alert.
+	RunEveryMinute int64            `yaml:"run_every,omitempty"`
+	Slack          *SlackConfig     `yaml:"slack,omitempty"`
+	Webhook        *WebhookConfig   `yaml:"webhook,omitempty"`
+	PagerDuty      *PagerDutyConfig `yaml:"pagerduty,omitempty"`
+	// HTML is a template of the html part of the email, sent along with the text.
+	// CC and Bcc are copied on the email, the Bcc recipients are not shown.
+	HTML *string  `yaml:"html,omitempty"`
+	CC   []string `yaml:"cc,omitempty"`
+	Bcc  []string `yaml:"bcc,omitempty"`
+}
+
+// MonitorTypeComposite is the type of the monitors over the states of other monitors.
+const MonitorTypeComposite = "composite"
+
+// Trigger severities of version 2 configs.
+const (
+	SeverityInfo     = "info"
+	SeverityWarn     = "warn"
+	SeverityCritical = "critical"
+)
+
+// SlackConfig is the incoming webhook the slack notifier posts to.
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Channel    string `yaml:"channel,omitempty"`
+	Username   string `yaml:"username,omitempty"`
+}
+
+// PagerDutyConfig is the Events API v2 integration the pagerduty notifier sends
+// to. The endpoint defaults to the PagerDuty one, and the severity to critical.
+type PagerDutyConfig struct {
+	RoutingKey string `yaml:"routing_key"`
+	Endpoint   string `yaml:"endpoint,omitempty"`
+	Severity   string `yaml:"severity,omitempty"`
+}
+
+// WebhookConfig is the endpoint the webhook notifier posts to. When the secret
+// is set, the body is signed with it.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Secret  string            `yaml:"secret,omitempty"`
 }
 
 type Monitor struct {
-	Metric            string    `yaml:"metric"`
-	Type              string    `yaml:"type"`
-	IntervalInSeconds int64     `yaml:"interval"`
-	Notifier          string    `yaml:"notifier"`
-	Triggers          []Trigger `yaml:"triggers"`
-	Subject           *string   `yaml:"subject"`
+	// ID is unique among the monitors of the agent, the name or the metric, type and tags of the
+	// monitor. It is set by the agent, and keys the leases, throttles and incidents of the monitor.
+	ID string `yaml:"-"`
+	// Name is how composite monitors reference the monitor. It defaults to the metric for composites.
+	Name              string `yaml:"name,omitempty"`
+	Metric            string `yaml:"metric"`
+	Type              string `yaml:"type"`
+	IntervalInSeconds int64  `yaml:"interval"`
+	// Expr is a ratio of two counters, like ratio(http.response.500, http.request.total).
+	// The metric defaults to the expr, and the type to a counter.
+	Expr string `yaml:"expr,omitempty"`
+	// Query is an expression over the metrics, like sum(http.response.500{route="/pay"}[5m]) / sum(http.request[5m]).
+	// The metric defaults to the query, and the series are grouped by the first metric of the query.
+	Query string `yaml:"query,omitempty"`
+	// MinDenominator is the least count of the denominator of the ratio for it to be checked.
+	MinDenominator float32 `yaml:"min_denominator,omitempty"`
+	// AbsentFor is how long the series can go unwritten before the monitor has no data.
+	AbsentFor time.Duration `yaml:"absent_for,omitempty"`
+	// Condition is the monitors a composite monitor combines with and, or and not,
+	// like "checkout_5xx and checkout_latency". It alerts while the condition holds.
+	Condition string `yaml:"condition,omitempty"`
+	// Baseline is used by the anomaly triggers, which can not be mixed with threshold triggers.
+	Baseline *BaselineConfig `yaml:"baseline,omitempty"`
+
+	Notifier    string            `yaml:"notifier"`
+	Aggregation string            `yaml:"aggregation,omitempty"`
+	Percentile  float64           `yaml:"percentile,omitempty"`
+	Tags        map[string]string `yaml:"tags,omitempty"`
+	GroupBy     []string          `yaml:"group_by,omitempty"`
+	Triggers    []Trigger         `yaml:"triggers"`
+	Subject     *string           `yaml:"subject"`
+	Slack       *SlackConfig      `yaml:"slack,omitempty"`
+	Webhook     *WebhookConfig    `yaml:"webhook,omitempty"`
+	PagerDuty   *PagerDutyConfig  `yaml:"pagerduty,omitempty"`
 }
 
+// MonitorConfig is the monitors.yaml file. Without a version, it is read as version 1.
 type MonitorConfig struct {
 	Version  int       `yaml:"version"`
 	Monitors []Monitor `yaml:"monitors"`
 }
 
-func ReadMonitoringConfig(configFile string, serviceName string) []Monitor {
+func ReadMonitoringConfig(configFile string, serviceName string, notifierNames ...string) []Monitor {
+	monitors, err := LoadMonitoringConfig(configFile, serviceName, notifierNames...)
+	utils.CheckErr(err, "failed to read monitors config ")
+
+	return monitors
+}
+
+// LoadMonitoringConfig reads the monitors like ReadMonitoringConfig, but returns
+// the error instead of exiting, for the config to be reloaded while running.
+// An invalid config returns ValidationErrors, with all of its problems.
+// Version 1 configs are converted, the triggers of the monitors always have channels.
+// The notifier names are the notifiers the config is validated against, see Validate.
+func LoadMonitoringConfig(configFile string, serviceName string, notifierNames ...string) ([]Monitor, error) {
 	b, err := ioutil.ReadFile(configFile)
-	utils.CheckErr(err, "failed to read config file")
+	if err != nil {
+		return nil, err
+	}
+
+	if errs := Validate(b, notifierNames...); len(errs) > 0 {
+		for i := range errs {
+			errs[i].File = configFile
+		}
+
+		return nil, errs
+	}
 
 	monitorCfg := MonitorConfig{}
 
-	err = yaml.Unmarshal(b, &monitorCfg)
-	utils.CheckErr(err, "failed to unmarshal monitors config")
+	if err := yaml.Unmarshal(b, &monitorCfg); err != nil {
+		return nil, err
+	}
+
+	if monitorCfg.Version < SupportedConfigVersion {
+		monitorCfg = ConvertV1(monitorCfg)
+	}
 
 	monitors := []Monitor{}
 
 	for _, monitor := range monitorCfg.Monitors {
-		for _, trigger := range monitor.Triggers {
-			if trigger.Subject == "" {
-				trigger.Subject = monitor.GetSubject(serviceName)
+		if monitor.Expr != "" && monitor.Metric == "" {
+			monitor.Metric = monitor.Expr
+		}
+
+		if monitor.Query != "" && monitor.Metric == "" {
+			monitor.Metric = monitor.Query
+		}
+
+		if monitor.Type == MonitorTypeComposite && monitor.Metric == "" {
+			monitor.Metric = monitor.Name
+		}
+
+		if monitor.Expr != "" && monitor.Type == "" {
+			monitor.Type = protocols.MetricTypeCounter.String()
+		}
+
+		for i := range monitor.Triggers {
+			for j := range monitor.Triggers[i].Channels {
+				if monitor.Triggers[i].Channels[j].Subject == "" {
+					monitor.Triggers[i].Channels[j].Subject = monitor.GetSubject(serviceName)
+				}
 			}
 		}
 
 		monitors = append(monitors, monitor)
 	}
 
-	return monitors
+	return monitors, nil
+}
+
+// ConvertV1 converts a version 1 config to the current version. The notifier
+// fields of every trigger become its only channel.
+func ConvertV1(cfg MonitorConfig) MonitorConfig {
+	converted := MonitorConfig{Version: SupportedConfigVersion}
+
+	for _, monitor := range cfg.Monitors {
+		triggers := make([]Trigger, 0, len(monitor.Triggers))
+
+		for _, t := range monitor.Triggers {
+			triggers = append(triggers, Trigger{
+				Threshold:    t.Threshold,
+				For:          t.For,
+				RecoverBelow: t.RecoverBelow,
+				Anomaly:      t.Anomaly,
+				Compare:      t.Compare,
+				Channels:     []Channel{t.channel()},
+			})
+		}
+
+		monitor.Triggers = triggers
+		converted.Monitors = append(converted.Monitors, monitor)
+	}
+
+	return converted
+}
+
+// Mode is what the trigger checks, the threshold, an anomaly or a comparison.
+func (t Trigger) Mode() string {
+	switch {
+	case t.Anomaly != nil:
+		return TriggerAnomaly
+	case t.Compare != nil:
+		return TriggerCompare
+	}
+
+	return TriggerThreshold
+}
+
+// Limit is the value the trigger alerts at, the sigma for anomaly triggers
+// and the factor for compare triggers.
+func (t Trigger) Limit() float32 {
+	switch {
+	case t.Anomaly != nil:
+		return t.Anomaly.Sigma
+	case t.Compare != nil:
+		return t.Compare.Factor
+	}
+
+	return t.Threshold
+}
+
+// channel is the notifier of a version 1 trigger.
+func (t Trigger) channel() Channel {
+	return Channel{
+		Notifier:       t.Notifier,
+		To:             t.To,
+		Text:           t.Text,
+		Subject:        t.Subject,
+		RunEveryMinute: t.RunEveryMinute,
+		Slack:          t.Slack,
+		Webhook:        t.Webhook,
+		PagerDuty:      t.PagerDuty,
+	}
 }
 
 func (m Monitor) GetSubject(app string) string {
@@ -62,3 +308,48 @@ func (m Monitor) GetSubject(app string) string {
 
 	return subject
 }
+
+// Mode is the mode of the triggers of the monitor.
+func (m Monitor) Mode() string {
+	if len(m.Triggers) == 0 {
+		return TriggerThreshold
+	}
+
+	return m.Triggers[0].Mode()
+}
+
+// SeriesMetric is the metric whose series the monitor checks, the denominator for a ratio,
+// and the first metric of a query.
+func (m Monitor) SeriesMetric() string {
+	if ratio, err := ParseExpr(m.Expr); err == nil {
+		return ratio.Denominator
+	}
+
+	if q, err := query.Parse(m.Query); m.Query != "" && err == nil && len(q.Metrics()) > 0 {
+		return q.Metrics()[0]
+	}
+
+	return m.Metric
+}
+
+// ChannelOf fills the notifier settings the channel does not have from the monitor,
+// so a monitor can set the notifier once for all its triggers.
+func (m Monitor) ChannelOf(c Channel) Channel {
+	if c.Notifier == "" {
+		c.Notifier = m.Notifier
+	}
+
+	if c.Slack == nil {
+		c.Slack = m.Slack
+	}
+
+	if c.Webhook == nil {
+		c.Webhook = m.Webhook
+	}
+
+	if c.PagerDuty == nil {
+		c.PagerDuty = m.PagerDuty
+	}
+
+	return c
+}
@@ -0,0 +1,38 @@
+package aggregator
+
+import (
+	"errors"
+	"hawkeye/quiver"
+	"strconv"
+	"strings"
+)
+
+const (
+	AggregationSum    = "sum"
+	AggregationUnique = "unique"
+)
+
+var ErrUnsupportedAggregation = errors.New("unsupported_aggregation")
+
+// New returns the aggregator for the aggregation name. Counters are summed with "sum",
+// gauges take "latest", "min", "max" or "avg", histograms a percentile like "p99" or "p99.9",
+// and sets are counted with "unique".
+func New(repo quiver.Repository, aggregation string) (Aggregator, error) {
+	switch {
+	case aggregation == AggregationSum:
+		return NewCountAggregator(repo), nil
+	case aggregation == AggregationUnique:
+		return NewUniqueAggregator(repo), nil
+	case IsGaugeAggregation(aggregation):
+		return NewGaugeAggregator(repo, aggregation), nil
+	case strings.HasPrefix(aggregation, "p"):
+		percentile, err := strconv.ParseFloat(strings.TrimPrefix(aggregation, "p"), 64)
+		if err != nil || !IsValidPercentile(percentile) {
+			return nil, ErrUnsupportedAggregation
+		}
+
+		return NewPercentileAggregator(repo, percentile), nil
+	}
+
+	return nil, ErrUnsupportedAggregation
+}
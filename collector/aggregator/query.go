@@ -0,0 +1,39 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hawkeye/collector/query"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"time"
+)
+
+// QueryAggregator evaluates the query of a monitor, like
+// sum(http.response.500[5m]) / sum(http.request[5m]), for the tags of the group.
+type QueryAggregator struct {
+	repo  quiver.Repository
+	query *query.Query
+}
+
+func NewQueryAggregator(repo quiver.Repository, q *query.Query) *QueryAggregator {
+	return &QueryAggregator{repo: repo, query: q}
+}
+
+// Collect ignores the metric, the series are the ones of the selectors of the query.
+func (q *QueryAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return q.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+}
+
+// CollectBetween is ErrInsufficientDenominator when the query divides by 0, so that the states
+// are kept, like for a ratio without requests.
+func (q *QueryAggregator) CollectBetween(ctx context.Context, _ string, tags quiver.Tags, from, to time.Time) (float32, error) {
+	value, err := q.query.Eval(ctx, q.repo, tags, from, to)
+	if errors.Is(err, query.ErrDivisionByZero) {
+		return 0, fmt.Errorf("%w: %s divides by 0", ErrInsufficientDenominator, q.query)
+	}
+
+	return float32(value), err
+}
@@ -0,0 +1,78 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrInvalidExpr = errors.New("invalid_expr")
+	// ErrInsufficientDenominator is a ratio which is not checked, its denominator under the min denominator.
+	ErrInsufficientDenominator = errors.New("insufficient_denominator")
+
+	ratioExpr = regexp.MustCompile(`^\s*ratio\(\s*([^\s,()]+)\s*,\s*([^\s,()]+)\s*\)\s*$`)
+)
+
+// Ratio is the expr of a monitor dividing a metric by another, like the 5xx
+// responses by all the requests: ratio(http.response.500, http.request.total).
+type Ratio struct {
+	Numerator   string
+	Denominator string
+}
+
+// ParseExpr parses the expr of a monitor, which is a ratio of two counters.
+func ParseExpr(expr string) (Ratio, error) {
+	match := ratioExpr.FindStringSubmatch(expr)
+	if match == nil {
+		return Ratio{}, fmt.Errorf("%w: %q, expected ratio(<metric>, <metric>)", ErrInvalidExpr, expr)
+	}
+
+	return Ratio{Numerator: match[1], Denominator: match[2]}, nil
+}
+
+func (r Ratio) String() string {
+	return fmt.Sprintf("ratio(%s, %s)", r.Numerator, r.Denominator)
+}
+
+// RatioAggregator divides the count of the numerator by the count of the denominator,
+// for the same tags and interval. While the denominator is under minDenominator, or 0,
+// there is no ratio, ErrInsufficientDenominator, so that a single error out of a handful
+// of requests does not alert, and a dip in the traffic does not resolve an alert.
+type RatioAggregator struct {
+	repo           quiver.Repository
+	ratio          Ratio
+	minDenominator float32
+}
+
+func NewRatioAggregator(repo quiver.Repository, ratio Ratio, minDenominator float32) *RatioAggregator {
+	return &RatioAggregator{repo: repo, ratio: ratio, minDenominator: minDenominator}
+}
+
+// Collect ignores the metric, the series are the ones of the numerator and denominator.
+func (r *RatioAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return r.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+}
+
+func (r *RatioAggregator) CollectBetween(ctx context.Context, _ string, tags quiver.Tags, from, to time.Time) (float32, error) {
+	denominator, err := r.repo.GetCountBetween(ctx, r.ratio.Denominator, tags, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	if denominator <= 0 || denominator < r.minDenominator {
+		return 0, fmt.Errorf("%w: %g under %g", ErrInsufficientDenominator, denominator, r.minDenominator)
+	}
+
+	numerator, err := r.repo.GetCountBetween(ctx, r.ratio.Numerator, tags, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	return numerator / denominator, nil
+}
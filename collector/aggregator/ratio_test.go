@@ -0,0 +1,144 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"hawkeye/quiver"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeRepo has the counts and last writes of the metrics whatever the tags, and the
+// baselines by key. The counts of the windows ending before before are the earlier ones.
+// It records the metrics, tags and windows it was read for.
+type fakeRepo struct {
+	quiver.Repository
+
+	counts     map[string]float32
+	earlier    map[string]float32
+	before     time.Time
+	lastWrites map[string]time.Time
+	baselines  map[string]quiver.Baseline
+	err        error
+
+	reads   []string
+	filters []quiver.Tags
+	windows [][2]time.Time
+}
+
+func (f *fakeRepo) GetCountBetween(_ context.Context, metric string, filter quiver.Tags, from, to time.Time) (float32, error) {
+	f.reads = append(f.reads, metric)
+	f.filters = append(f.filters, filter)
+	f.windows = append(f.windows, [2]time.Time{from, to})
+
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	if to.Before(f.before) {
+		return f.earlier[metric], nil
+	}
+
+	return f.counts[metric], nil
+}
+
+var (
+	collectTo   = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	collectFrom = collectTo.Add(-time.Minute)
+)
+
+func TestParseExpr(t *testing.T) {
+	r, err := ParseExpr(" ratio( http.response.500 ,http.request ) ")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if r.Numerator != "http.response.500" || r.Denominator != "http.request" {
+		t.Errorf("unexpected ratio %+v", r)
+	}
+
+	if r.String() != "ratio(http.response.500, http.request)" {
+		t.Errorf("unexpected ratio %s", r)
+	}
+
+	for _, expr := range []string{"", "http.response.500 / http.request", "ratio(a)", "ratio(a, b, c)", "ratio(a, (b))"} {
+		if _, err := ParseExpr(expr); !errors.Is(err, ErrInvalidExpr) {
+			t.Errorf("%q: expected ErrInvalidExpr, got %v", expr, err)
+		}
+	}
+}
+
+func TestRatioAggregator(t *testing.T) {
+	ratio := Ratio{Numerator: "http.response.500", Denominator: "http.request"}
+
+	tests := []struct {
+		name           string
+		numerator      float32
+		denominator    float32
+		minDenominator float32
+		value          float32
+		err            error
+	}{
+		{"ratio", 5, 100, 0, 0.05, nil},
+		{"no errors", 0, 100, 0, 0, nil},
+		{"no traffic", 0, 0, 0, 0, ErrInsufficientDenominator},
+		{"errors without traffic", 3, 0, 0, 0, ErrInsufficientDenominator},
+		{"under the min denominator", 3, 19, 20, 0, ErrInsufficientDenominator},
+		{"at the min denominator", 3, 20, 20, 0.15, nil},
+		{"over the min denominator", 30, 200, 20, 0.15, nil},
+	}
+
+	for _, tt := range tests {
+		repo := &fakeRepo{counts: map[string]float32{"http.response.500": tt.numerator, "http.request": tt.denominator}}
+		r := NewRatioAggregator(repo, ratio, tt.minDenominator)
+
+		value, err := r.CollectBetween(context.Background(), "ignored", nil, collectFrom, collectTo)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+			continue
+		}
+
+		if math.Abs(float64(value-tt.value)) > 1e-6 {
+			t.Errorf("%s: expected %g, got %g", tt.name, tt.value, value)
+		}
+
+		// the numerator is not read without a ratio
+		if tt.err != nil && len(repo.reads) != 1 {
+			t.Errorf("%s: expected only the denominator to be read, got %v", tt.name, repo.reads)
+		}
+	}
+}
+
+func TestRatioAggregatorSeries(t *testing.T) {
+	repo := &fakeRepo{counts: map[string]float32{"http.response.500": 1, "http.request": 10}}
+	group := quiver.Tags{"route": "/pay"}
+
+	r := NewRatioAggregator(repo, Ratio{Numerator: "http.response.500", Denominator: "http.request"}, 0)
+	if _, err := r.CollectBetween(context.Background(), "ignored", group, collectFrom, collectTo); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// both metrics are read for the group and window
+	if len(repo.reads) != 2 || repo.reads[0] != "http.request" || repo.reads[1] != "http.response.500" {
+		t.Errorf("expected the denominator and numerator to be read, got %v", repo.reads)
+	}
+
+	for i := range repo.reads {
+		if repo.filters[i].String() != group.String() || repo.windows[i] != [2]time.Time{collectFrom, collectTo} {
+			t.Errorf("expected %s to be read for %s over the window, got %s over %v", repo.reads[i], group, repo.filters[i], repo.windows[i])
+		}
+	}
+}
+
+func TestRatioAggregatorRepositoryError(t *testing.T) {
+	repo := &fakeRepo{err: errors.New("connection refused")}
+
+	r := NewRatioAggregator(repo, Ratio{Numerator: "http.response.500", Denominator: "http.request"}, 0)
+
+	// an error is not a lack of traffic
+	_, err := r.CollectBetween(context.Background(), "ignored", nil, collectFrom, collectTo)
+	if !errors.Is(err, repo.err) || errors.Is(err, ErrInsufficientDenominator) {
+		t.Errorf("expected the error of the repository, got %v", err)
+	}
+}
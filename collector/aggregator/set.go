@@ -0,0 +1,27 @@
+package aggregator
+
+import (
+	"context"
+	"hawkeye/quiver"
+	"hawkeye/utils"
+	"time"
+)
+
+// UniqueAggregator counts the unique members of a set metric in the interval.
+// The count is approximate, sets are stored as HyperLogLogs.
+type UniqueAggregator struct {
+	repo quiver.Repository
+}
+
+func NewUniqueAggregator(repo quiver.Repository) *UniqueAggregator {
+	return &UniqueAggregator{repo: repo}
+}
+
+func (u *UniqueAggregator) Collect(ctx context.Context, metric string, tags quiver.Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return u.CollectBetween(ctx, metric, tags, now.Add(-interval), now)
+}
+
+func (u *UniqueAggregator) CollectBetween(ctx context.Context, metric string, tags quiver.Tags, from, to time.Time) (float32, error) {
+	return u.repo.GetSetBetween(ctx, metric, tags, from, to)
+}
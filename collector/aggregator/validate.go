@@ -0,0 +1,676 @@
+package aggregator
+
+import (
+	"errors"
+	"fmt"
+	"hawkeye/collector/query"
+	"hawkeye/protocols"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem of the monitors config, at the line and column
+// of the yaml it was found at. Path is the field, like monitors[0].triggers[1].threshold.
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteString(":")
+	}
+
+	// the errors of yaml itself only have the line
+	if e.Column > 0 {
+		fmt.Fprintf(&b, "%d:%d: ", e.Line, e.Column)
+	} else {
+		fmt.Fprintf(&b, "%d: ", e.Line)
+	}
+
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// ValidationErrors are all the problems of the monitors config, in the order of the file.
+type ValidationErrors []ValidationError
+
+var ErrInvalidMonitorConfig = errors.New("invalid_monitor_config")
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, len(errs)+1)
+	lines = append(lines, fmt.Sprintf("%s: %d problems", ErrInvalidMonitorConfig, len(errs)))
+
+	for _, err := range errs {
+		lines = append(lines, "  "+err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (errs ValidationErrors) Unwrap() error {
+	return ErrInvalidMonitorConfig
+}
+
+// SupportedConfigVersion is the latest version of the monitors config this agent
+// reads. Version 1 configs are still read, and converted on load.
+const SupportedConfigVersion = 2
+
+// DefaultNotifierNames are the notifiers of the default notifier registry, the ones
+// channels are validated against when Validate is not given the registered names.
+var DefaultNotifierNames = []string{"email", "slack", "webhook", "pagerduty"}
+
+var (
+	yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// yamlErrorValue is the value of a type error, cut to 7 characters and ... when it is longer than 10
+	yamlErrorValue = regexp.MustCompile("^cannot unmarshal !!\\w+ `(.*)` into ")
+
+	triggerSeverities   = map[string]bool{"": true, SeverityInfo: true, SeverityWarn: true, SeverityCritical: true}
+	pagerDutySeverities = map[string]bool{"": true, "critical": true, "error": true, "warning": true, "info": true}
+
+	// v1NotifierFields are the notifier fields of version 1 triggers, which are on the channels in version 2
+	v1NotifierFields = []string{"notifier", "to", "text", "subject", "run_every", "slack", "webhook", "pagerduty"}
+
+	// compositeUnsupportedFields are the fields of the monitors over a metric, which composites do not have
+	compositeUnsupportedFields = []string{"metric", "expr", "query", "min_denominator", "absent_for", "baseline", "aggregation", "percentile", "tags", "group_by"}
+)
+
+// Validate checks the monitors config, and returns all the problems found, not
+// only the first one. It is nil when the config is valid. The notifiers of the
+// monitors and channels should be one of the notifier names, the names of the
+// notifier registry, or DefaultNotifierNames without names.
+func Validate(data []byte, notifierNames ...string) ValidationErrors {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return yamlErrors(err, nil)
+	}
+
+	var cfg MonitorConfig
+	if err := root.Decode(&cfg); err != nil {
+		return yamlErrors(err, &root)
+	}
+
+	if len(notifierNames) == 0 {
+		notifierNames = DefaultNotifierNames
+	}
+
+	// without a notifier, the monitor is notified by email
+	v := &validator{notifiers: map[string]bool{"": true}}
+	for _, name := range notifierNames {
+		v.notifiers[name] = true
+	}
+
+	doc := &root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+
+	v.unknownFields(doc, "", reflect.TypeOf(cfg))
+
+	version := cfg.Version
+	if version == 0 {
+		version = 1
+	}
+
+	if version < 1 || version > SupportedConfigVersion {
+		v.add(field(doc, "version"), "version", "unsupported version %d, expected 1 to %d", cfg.Version, SupportedConfigVersion)
+	}
+
+	monitors := field(doc, "monitors")
+	if len(cfg.Monitors) == 0 {
+		v.add(or(monitors, doc), "monitors", "no monitors configured")
+	}
+
+	v.names(cfg.Monitors, monitors)
+
+	for i, monitor := range cfg.Monitors {
+		v.monitor(monitor, version, item(monitors, i), fmt.Sprintf("monitors[%d]", i))
+	}
+
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		if v.errs[i].Line != v.errs[j].Line {
+			return v.errs[i].Line < v.errs[j].Line
+		}
+		return v.errs[i].Column < v.errs[j].Column
+	})
+
+	return v.errs
+}
+
+type validator struct {
+	errs ValidationErrors
+
+	// notifiers are the notifier names channels can use
+	notifiers map[string]bool
+
+	// monitors are the types of the named monitors, and referenced the ones a composite references.
+	monitors   map[string]string
+	referenced map[string]bool
+}
+
+func (v *validator) names(monitors []Monitor, node *yaml.Node) {
+	v.monitors = map[string]string{}
+	v.referenced = map[string]bool{}
+
+	for i, m := range monitors {
+		if m.Name == "" {
+			continue
+		}
+
+		nameNode, path := field(item(node, i), "name"), fmt.Sprintf("monitors[%d].name", i)
+
+		if !IsValidMonitorName(m.Name) {
+			v.add(nameNode, path, "invalid name %q, expected letters, digits, _ or -", m.Name)
+		}
+
+		if _, ok := v.monitors[m.Name]; ok {
+			v.add(nameNode, path, "duplicate monitor name %q", m.Name)
+		}
+
+		v.monitors[m.Name] = m.Type
+	}
+
+	for _, m := range monitors {
+		if condition, err := ParseCondition(m.Condition); m.Type == MonitorTypeComposite && err == nil {
+			for _, name := range condition.Names() {
+				v.referenced[name] = true
+			}
+		}
+	}
+}
+
+func (v *validator) add(node *yaml.Node, path, format string, args ...interface{}) {
+	err := ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		err.Line, err.Column = node.Line, node.Column
+	}
+
+	v.errs = append(v.errs, err)
+}
+
+func (v *validator) monitor(m Monitor, version int, node *yaml.Node, path string) {
+	v.unknownFields(node, path, reflect.TypeOf(m))
+
+	if m.Type == MonitorTypeComposite {
+		v.composite(m, version, node, path)
+		return
+	}
+
+	if m.Condition != "" {
+		v.add(field(node, "condition"), path+".condition", "condition is only supported for composite monitors")
+	}
+
+	switch {
+	case m.Expr != "" && m.Query != "":
+		v.add(field(node, "query"), path+".query", "a monitor can not have both expr and query")
+	case m.Expr != "":
+		v.expr(m, node, path)
+	case m.Query != "":
+		v.query(m, node, path)
+	case m.Metric == "":
+		v.add(or(field(node, "metric"), node), path+".metric", "metric is required")
+	}
+
+	if m.Expr == "" && m.MinDenominator != 0 {
+		v.add(field(node, "min_denominator"), path+".min_denominator", "min_denominator is only supported with expr")
+	}
+
+	metricType, err := protocols.ParseMetricType(m.Type)
+	if err != nil && !((m.Expr != "" || m.Query != "") && m.Type == "") {
+		v.add(or(field(node, "type"), node), path+".type", "unknown type %q, expected one of c, g, h, ms, d or s", m.Type)
+	}
+
+	if m.IntervalInSeconds < 0 {
+		v.add(field(node, "interval"), path+".interval", "interval can not be negative")
+	}
+
+	if m.AbsentFor < 0 {
+		v.add(field(node, "absent_for"), path+".absent_for", "absent_for can not be negative")
+	}
+
+	if m.Aggregation != "" && (metricType != protocols.MetricTypeGauge || !IsGaugeAggregation(m.Aggregation)) {
+		v.add(field(node, "aggregation"), path+".aggregation", "aggregation %q is only supported for gauges, as latest, min, max or avg", m.Aggregation)
+	}
+
+	isDistribution := metricType == protocols.MetricTypeHistogram ||
+		metricType == protocols.MetricTypeTimer ||
+		metricType == protocols.MetricTypeDistribution
+
+	if isDistribution && !IsValidPercentile(m.Percentile) {
+		v.add(or(field(node, "percentile"), node), path+".percentile", "percentile should be over 0 and up to 100")
+	}
+
+	if !v.notifiers[m.Notifier] {
+		v.add(field(node, "notifier"), path+".notifier", "unknown notifier %q", m.Notifier)
+	}
+
+	for i, key := range m.GroupBy {
+		if key == "" {
+			v.add(item(field(node, "group_by"), i), fmt.Sprintf("%s.group_by[%d]", path, i), "group by tag can not be empty")
+		}
+	}
+
+	triggers := field(node, "triggers")
+	if len(m.Triggers) == 0 {
+		v.add(or(triggers, node), path+".triggers", "no triggers configured")
+	}
+
+	for i, trigger := range m.Triggers {
+		triggerNode, triggerPath := item(triggers, i), fmt.Sprintf("%s.triggers[%d]", path, i)
+
+		if trigger.Mode() != m.Mode() {
+			v.add(triggerNode, triggerPath, "%s and %s triggers can not be mixed in a monitor", trigger.Mode(), m.Mode())
+		}
+
+		if trigger.Compare != nil && m.Triggers[0].Compare != nil && trigger.Compare.Offset != m.Triggers[0].Compare.Offset {
+			v.add(field(field(triggerNode, "compare"), "offset"), triggerPath+".compare.offset", "the compare triggers of a monitor should have the same offset")
+		}
+
+		if trigger.Compare != nil && m.Triggers[0].Compare != nil && trigger.Compare.MinPrevious != m.Triggers[0].Compare.MinPrevious {
+			v.add(field(field(triggerNode, "compare"), "min_previous"), triggerPath+".compare.min_previous", "the compare triggers of a monitor should have the same min_previous")
+		}
+
+		v.trigger(m, trigger, version, triggerNode, triggerPath)
+	}
+
+	if m.Baseline != nil {
+		v.baseline(m, field(node, "baseline"), path+".baseline")
+	}
+}
+
+func (v *validator) baseline(m Monitor, node *yaml.Node, path string) {
+	v.unknownFields(node, path, reflect.TypeOf(*m.Baseline))
+
+	if m.Mode() != TriggerAnomaly {
+		v.add(node, path, "baseline is only used by anomaly triggers")
+	}
+
+	b := m.Baseline
+
+	if b.Alpha < 0 || b.Alpha > 1 {
+		v.add(field(node, "alpha"), path+".alpha", "alpha should be over 0 and up to 1")
+	}
+
+	if b.Warmup < 0 {
+		v.add(field(node, "warmup"), path+".warmup", "warmup can not be negative")
+	}
+
+	if b.Seasonality != "" && b.Seasonality != SeasonalityWeekly {
+		v.add(field(node, "seasonality"), path+".seasonality", "unknown seasonality %q, expected weekly", b.Seasonality)
+	}
+
+	if b.MinStddev < 0 {
+		v.add(field(node, "min_stddev"), path+".min_stddev", "min_stddev can not be negative")
+	}
+}
+
+// composite checks a composite monitor, whose condition references the other monitors
+// by name, and whose triggers alert while the condition holds.
+func (v *validator) composite(m Monitor, version int, node *yaml.Node, path string) {
+	if m.Name == "" {
+		v.add(or(field(node, "name"), node), path+".name", "composite monitors need a name")
+	}
+
+	for _, key := range compositeUnsupportedFields {
+		if value := field(node, key); value != nil {
+			v.add(value, path+"."+key, "%s is not supported for composite monitors", key)
+		}
+	}
+
+	if m.IntervalInSeconds < 0 {
+		v.add(field(node, "interval"), path+".interval", "interval can not be negative")
+	}
+
+	if !v.notifiers[m.Notifier] {
+		v.add(field(node, "notifier"), path+".notifier", "unknown notifier %q", m.Notifier)
+	}
+
+	conditionNode := or(field(node, "condition"), node)
+
+	if m.Condition == "" {
+		v.add(conditionNode, path+".condition", "composite monitors need a condition")
+	} else if condition, err := ParseCondition(m.Condition); err != nil {
+		v.add(conditionNode, path+".condition", "invalid condition, %s", strings.TrimPrefix(err.Error(), ErrInvalidCondition.Error()+": "))
+	} else {
+		for _, name := range condition.Names() {
+			switch typ, ok := v.monitors[name]; {
+			case name == m.Name:
+				v.add(conditionNode, path+".condition", "a composite monitor can not reference itself")
+			case !ok:
+				v.add(conditionNode, path+".condition", "unknown monitor %q", name)
+			case typ == MonitorTypeComposite:
+				v.add(conditionNode, path+".condition", "composite monitor %q can not be referenced by another composite", name)
+			}
+		}
+	}
+
+	triggers := field(node, "triggers")
+	if len(m.Triggers) == 0 {
+		v.add(or(triggers, node), path+".triggers", "no triggers configured")
+	}
+
+	for i, trigger := range m.Triggers {
+		triggerNode, triggerPath := item(triggers, i), fmt.Sprintf("%s.triggers[%d]", path, i)
+
+		if trigger.Mode() != TriggerThreshold {
+			v.add(field(triggerNode, trigger.Mode()), triggerPath+"."+trigger.Mode(), "composite monitors do not support %s triggers", trigger.Mode())
+			continue
+		}
+
+		v.trigger(m, trigger, version, triggerNode, triggerPath)
+	}
+}
+
+// expr checks the ratio of the monitor, which is only over counters.
+func (v *validator) expr(m Monitor, node *yaml.Node, path string) {
+	if _, err := ParseExpr(m.Expr); err != nil {
+		v.add(field(node, "expr"), path+".expr", "invalid expr %q, expected ratio(<metric>, <metric>)", m.Expr)
+	}
+
+	if m.Type != "" && !protocols.Is(m.Type, protocols.MetricTypeCounter) {
+		v.add(field(node, "type"), path+".type", "expr is only supported for counters")
+	}
+
+	if m.MinDenominator < 0 {
+		v.add(field(node, "min_denominator"), path+".min_denominator", "min_denominator can not be negative")
+	}
+}
+
+// query checks the query of the monitor, the functions of the query tell the metric types.
+func (v *validator) query(m Monitor, node *yaml.Node, path string) {
+	q, err := query.Parse(m.Query)
+	if err != nil {
+		v.add(field(node, "query"), path+".query", "invalid query %q, %v", m.Query, err)
+		return
+	}
+
+	if len(q.Metrics()) == 0 {
+		v.add(field(node, "query"), path+".query", "query %q has no metric", m.Query)
+	}
+
+	if m.Type != "" {
+		v.add(field(node, "type"), path+".type", "type is not used with a query, the functions of the query tell the metric types")
+	}
+}
+
+func (v *validator) trigger(m Monitor, t Trigger, version int, node *yaml.Node, path string) {
+	v.unknownFields(node, path, reflect.TypeOf(t))
+
+	if t.Anomaly != nil {
+		v.unknownFields(field(node, "anomaly"), path+".anomaly", reflect.TypeOf(*t.Anomaly))
+	}
+
+	if t.Compare != nil {
+		v.unknownFields(field(node, "compare"), path+".compare", reflect.TypeOf(*t.Compare))
+	}
+
+	composite := m.Type == MonitorTypeComposite
+
+	switch {
+	case composite && t.Threshold != 0:
+		v.add(field(node, "threshold"), path+".threshold", "composite triggers do not have a threshold, they alert while the condition holds")
+	case t.Anomaly != nil && t.Compare != nil:
+		v.add(field(node, "compare"), path+".compare", "a trigger can not have both anomaly and compare")
+	case t.Mode() != TriggerThreshold && t.Threshold != 0:
+		v.add(field(node, "threshold"), path+".threshold", "%s triggers do not have a threshold", t.Mode())
+	case t.Anomaly != nil && t.Anomaly.Sigma <= 0:
+		v.add(or(field(field(node, "anomaly"), "sigma"), field(node, "anomaly")), path+".anomaly.sigma", "sigma should be more than 0")
+	case t.Compare != nil && t.Compare.Offset <= 0:
+		v.add(or(field(field(node, "compare"), "offset"), field(node, "compare")), path+".compare.offset", "offset should be more than 0")
+	case t.Compare != nil && t.Compare.Factor <= 1:
+		v.add(or(field(field(node, "compare"), "factor"), field(node, "compare")), path+".compare.factor", "factor should be more than 1")
+	case t.Compare != nil && t.Compare.MinPrevious < 0:
+		v.add(field(field(node, "compare"), "min_previous"), path+".compare.min_previous", "min_previous can not be negative")
+	case !composite && t.Mode() == TriggerThreshold && t.Threshold <= 0:
+		v.add(or(field(node, "threshold"), node), path+".threshold", "threshold should be more than 0")
+	}
+
+	if composite && t.RecoverBelow != nil {
+		v.add(field(node, "recover_below"), path+".recover_below", "composite triggers recover when the condition no longer holds")
+	} else if t.RecoverBelow != nil && (*t.RecoverBelow < 0 || *t.RecoverBelow > t.Limit()) {
+		v.add(field(node, "recover_below"), path+".recover_below", "recover_below should be between 0 and the threshold %g", t.Limit())
+	}
+
+	if t.For < 0 {
+		v.add(field(node, "for"), path+".for", "for can not be negative")
+	}
+
+	if version < 2 {
+		if t.Severity != "" {
+			v.add(field(node, "severity"), path+".severity", "severity is only supported in version 2")
+		}
+
+		if len(t.Channels) > 0 {
+			v.add(field(node, "channels"), path+".channels", "channels are only supported in version 2")
+		}
+
+		v.channel(m.ChannelOf(t.channel()), node, path)
+		return
+	}
+
+	if !triggerSeverities[t.Severity] {
+		v.add(field(node, "severity"), path+".severity", "unknown severity %q, expected info, warn or critical", t.Severity)
+	}
+
+	for _, key := range v1NotifierFields {
+		if value := field(node, key); value != nil {
+			v.add(value, path+"."+key, "%s is set on the channels of the trigger in version 2", key)
+		}
+	}
+
+	channels := field(node, "channels")
+	if len(t.Channels) == 0 && !v.referenced[m.Name] {
+		v.add(or(channels, node), path+".channels", "no channels configured")
+	}
+
+	for i, channel := range t.Channels {
+		channelNode, channelPath := item(channels, i), fmt.Sprintf("%s.channels[%d]", path, i)
+
+		v.unknownFields(channelNode, channelPath, reflect.TypeOf(channel))
+		v.channel(m.ChannelOf(channel), channelNode, channelPath)
+	}
+}
+
+// channel checks the notifier of the channel, which is the trigger itself in version 1.
+func (v *validator) channel(c Channel, node *yaml.Node, path string) {
+	if c.RunEveryMinute < 0 {
+		v.add(field(node, "run_every"), path+".run_every", "run_every can not be negative")
+	}
+
+	if c.Text != nil {
+		if _, err := template.New("text").Parse(*c.Text); err != nil {
+			v.add(field(node, "text"), path+".text", "invalid template: %v", err)
+		}
+	}
+
+	if c.HTML != nil {
+		if _, err := template.New("html").Parse(*c.HTML); err != nil {
+			v.add(field(node, "html"), path+".html", "invalid template: %v", err)
+		}
+	}
+
+	// the notifier of the monitor is checked with the monitor
+	if notifier := field(node, "notifier"); notifier != nil && !v.notifiers[c.Notifier] {
+		v.add(notifier, path+".notifier", "unknown notifier %q", c.Notifier)
+	}
+
+	if c.Notifier != "" && c.Notifier != "email" {
+		for _, key := range []string{"html", "cc", "bcc"} {
+			if value := field(node, key); value != nil {
+				v.add(value, path+"."+key, "%s is only supported by email notifiers", key)
+			}
+		}
+	}
+
+	switch c.Notifier {
+	case "", "email":
+		if len(c.To) == 0 {
+			v.add(or(field(node, "to"), node), path+".to", "email notifiers need at least one recipient")
+		}
+
+		v.addresses(c.To, node, path, "to")
+		v.addresses(c.CC, node, path, "cc")
+		v.addresses(c.Bcc, node, path, "bcc")
+
+	case "slack":
+		if c.Slack == nil || c.Slack.WebhookURL == "" {
+			v.add(node, path+".slack.webhook_url", "slack notifiers need a webhook_url")
+		}
+
+	case "webhook":
+		if c.Webhook == nil || c.Webhook.URL == "" {
+			v.add(node, path+".webhook.url", "webhook notifiers need a url")
+		}
+
+	case "pagerduty":
+		if c.PagerDuty == nil || c.PagerDuty.RoutingKey == "" {
+			v.add(node, path+".pagerduty.routing_key", "pagerduty notifiers need a routing_key")
+		} else if !pagerDutySeverities[c.PagerDuty.Severity] {
+			v.add(node, path+".pagerduty.severity", "unknown severity %q, expected critical, error, warning or info", c.PagerDuty.Severity)
+		}
+	}
+}
+
+func (v *validator) addresses(addresses []string, node *yaml.Node, path, key string) {
+	for i, address := range addresses {
+		if _, err := mail.ParseAddress(address); err != nil {
+			v.add(item(field(node, key), i), fmt.Sprintf("%s.%s[%d]", path, key, i), "invalid email address %q", address)
+		}
+	}
+}
+
+// unknownFields reports the keys of the mapping which are not yaml fields of the struct,
+// the typos which yaml would otherwise ignore.
+func (v *validator) unknownFields(node *yaml.Node, path string, t reflect.Type) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	known := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !known[key.Value] {
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			v.add(key, keyPath, "unknown field %q", key.Value)
+		}
+	}
+}
+
+// yamlErrors turns the syntax and type errors of yaml, which only have the line, into validation errors.
+// The column of a type error is the one of its value in the root node, when it is decoded from one.
+func yamlErrors(err error, root *yaml.Node) ValidationErrors {
+	messages := []string{err.Error()}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	errs := ValidationErrors{}
+	for _, message := range messages {
+		verr := ValidationError{Message: message}
+
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			verr.Line, _ = strconv.Atoi(match[1])
+			verr.Message = match[2]
+
+			if value := yamlErrorValue.FindStringSubmatch(verr.Message); value != nil {
+				if node := scalarAt(root, verr.Line, value[1]); node != nil {
+					verr.Column = node.Column
+				}
+			}
+		}
+
+		errs = append(errs, verr)
+	}
+
+	return errs
+}
+
+// scalarAt is the last scalar node of the line with the value, the value rather than a key
+// of the same text. A value ending with ... is the start of the value.
+func scalarAt(node *yaml.Node, line int, value string) *yaml.Node {
+	if node == nil || node.Line > line {
+		return nil
+	}
+
+	var found *yaml.Node
+
+	if node.Kind == yaml.ScalarNode && node.Line == line {
+		prefix := strings.TrimSuffix(value, "...")
+		if node.Value == value || (prefix != value && strings.HasPrefix(node.Value, prefix)) {
+			found = node
+		}
+	}
+
+	for _, child := range node.Content {
+		if n := scalarAt(child, line, value); n != nil {
+			found = n
+		}
+	}
+
+	return found
+}
+
+// field is the value node of the key in the mapping node, nil if it is not there.
+func field(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// item is the i-th node of the sequence node, nil if it is not there.
+func item(node *yaml.Node, i int) *yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return nil
+	}
+
+	return node.Content[i]
+}
+
+// or is the first node which is found, for the missing fields to point at their parent.
+func or(nodes ...*yaml.Node) *yaml.Node {
+	for _, node := range nodes {
+		if node != nil {
+			return node
+		}
+	}
+
+	return nil
+}
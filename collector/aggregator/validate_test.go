@@ -0,0 +1,224 @@
+package aggregator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errs   []string
+	}{
+		{
+			name: "v1 unknown notifier of the monitor",
+			config: `
+monitors:
+  - metric: http.request
+    type: c
+    notifier: sms
+    triggers:
+      - threshold: 10
+        to: [oncall@example.com]
+`,
+			errs: []string{`5:15: monitors[0].notifier: unknown notifier "sms"`},
+		},
+		{
+			name: "v1 unknown notifier of the trigger",
+			config: `
+monitors:
+  - metric: http.request
+    type: c
+    triggers:
+      - threshold: 10
+        to: [oncall@example.com]
+      - threshold: 20
+        notifier: sms
+`,
+			errs: []string{`9:19: monitors[0].triggers[1].notifier: unknown notifier "sms"`},
+		},
+		{
+			name: "v1 bad duration",
+			config: `
+monitors:
+  - metric: http.request
+    type: c
+    triggers:
+      - threshold: 10
+        for: 5x
+        to: [oncall@example.com]
+`,
+			errs: []string{"7:14: cannot unmarshal !!str `5x` into time.Duration"},
+		},
+		{
+			name: "v1 missing metric",
+			config: `
+monitors:
+  - type: c
+    triggers:
+      - threshold: 10
+        to: [oncall@example.com]
+`,
+			errs: []string{"3:5: monitors[0].metric: metric is required"},
+		},
+		{
+			name: "v2 unknown notifiers",
+			config: `
+version: 2
+monitors:
+  - metric: http.request
+    type: c
+    notifier: sms
+    triggers:
+      - threshold: 10
+        channels:
+          - notifier: pager
+          - to: [oncall@example.com]
+            notifier: email
+`,
+			errs: []string{
+				`6:15: monitors[0].notifier: unknown notifier "sms"`,
+				`10:23: monitors[0].triggers[0].channels[0].notifier: unknown notifier "pager"`,
+			},
+		},
+		{
+			name: "v2 bad duration",
+			config: `
+version: 2
+monitors:
+  - metric: http.response.500
+    type: c
+    triggers:
+      - compare:
+          offset: one day ago
+          factor: 3
+        channels:
+          - to: [oncall@example.com]
+`,
+			// yaml cuts the longer values
+			errs: []string{"8:19: cannot unmarshal !!str `one day...` into time.Duration"},
+		},
+		{
+			name: "v2 missing metric",
+			config: `
+version: 2
+monitors:
+  - metric: cpu
+    type: g
+    triggers:
+      - threshold: 10
+        channels:
+          - to: [oncall@example.com]
+  - type: c
+    triggers:
+      - threshold: 10
+        channels:
+          - to: [oncall@example.com]
+`,
+			errs: []string{"10:5: monitors[1].metric: metric is required"},
+		},
+		{
+			name: "v2 problems in the order of the file",
+			config: `
+version: 3
+monitors:
+  - metric: http.request
+    type: c
+    tresholds: 2
+    triggers:
+      - threshold: 0
+        to: [oncall@example.com]
+        channels:
+          - to: [not an address]
+            sever: warn
+`,
+			errs: []string{
+				"2:10: version: unsupported version 3, expected 1 to 2",
+				`6:5: monitors[0].tresholds: unknown field "tresholds"`,
+				"8:20: monitors[0].triggers[0].threshold: threshold should be more than 0",
+				"9:13: monitors[0].triggers[0].to: to is set on the channels of the trigger in version 2",
+				`11:18: monitors[0].triggers[0].channels[0].to[0]: invalid email address "not an address"`,
+				`12:13: monitors[0].triggers[0].channels[0].sever: unknown field "sever"`,
+			},
+		},
+		{
+			name: "syntax error",
+			config: `
+monitors:
+  - metric: "http.request
+    type: c
+`,
+			// yaml only has the line of its syntax errors, the one of the unterminated quote
+			errs: []string{"3: found unexpected end of stream"},
+		},
+	}
+
+	for _, tt := range tests {
+		errs := Validate([]byte(tt.config))
+
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Error()
+		}
+
+		if strings.Join(messages, "\n") != strings.Join(tt.errs, "\n") {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, strings.Join(tt.errs, "\n"), strings.Join(messages, "\n"))
+		}
+	}
+}
+
+func TestValidateNotifierNames(t *testing.T) {
+	config := []byte(`
+version: 2
+monitors:
+  - metric: http.request
+    type: c
+    triggers:
+      - threshold: 10
+        channels:
+          - notifier: sms
+`)
+
+	if errs := Validate(config); len(errs) != 1 {
+		t.Errorf("expected sms to be unknown to the default notifiers, got %v", errs)
+	}
+
+	if errs := Validate(config, "sms"); errs != nil {
+		t.Errorf("expected the registered notifier to be valid, got %v", errs)
+	}
+}
+
+func TestValidateExample(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "..", "monitors.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if errs := Validate(b); errs != nil {
+		t.Errorf("expected the example config to be valid, got %v", errs)
+	}
+}
+
+func TestLoadMonitoringConfigErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "monitors.yaml")
+	if err := os.WriteFile(file, []byte("monitors:\n  - type: c\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_, err := LoadMonitoringConfig(file, "checkout")
+	if !errors.Is(err, ErrInvalidMonitorConfig) {
+		t.Fatalf("expected ErrInvalidMonitorConfig, got %v", err)
+	}
+
+	expected := "invalid_monitor_config: 2 problems\n" +
+		"  " + file + ":2:5: monitors[0].metric: metric is required\n" +
+		"  " + file + ":2:5: monitors[0].triggers: no triggers configured"
+
+	if err.Error() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, err)
+	}
+}
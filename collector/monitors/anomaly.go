@@ -0,0 +1,25 @@
+package monitors
+
+import (
+	"fmt"
+)
+
+// AnomalyMonitor watches how far a metric deviates from its baseline. The value is the
+// deviation in standard deviations, computed by the aggregator passed with WithAggregateFunc,
+// and the thresholds are the sigma of the anomaly triggers.
+type AnomalyMonitor struct {
+	*CounterMonitor
+}
+
+func NewAnomalyMonitor(name, env string, opts ...CounterMonitorOpts) *AnomalyMonitor {
+	am := &AnomalyMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+	}
+	am.describe = am.exceeded
+
+	return am
+}
+
+func (a *AnomalyMonitor) exceeded(series string, value, threshold float32) string {
+	return fmt.Sprintf("%s is %.1f sigma away from its baseline, over %g sigma in %s", series, value, threshold, a.env)
+}
@@ -0,0 +1,28 @@
+package monitors
+
+import (
+	"fmt"
+	"time"
+)
+
+// CompareMonitor watches the growth of a metric from the same window, offset earlier.
+// The value is the factor of the growth, computed by the aggregator passed with
+// WithAggregateFunc, and the thresholds are the factors of the compare triggers.
+type CompareMonitor struct {
+	*CounterMonitor
+	offset time.Duration
+}
+
+func NewCompareMonitor(name, env string, offset time.Duration, opts ...CounterMonitorOpts) *CompareMonitor {
+	cm := &CompareMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+		offset:         offset,
+	}
+	cm.describe = cm.exceeded
+
+	return cm
+}
+
+func (c *CompareMonitor) exceeded(series string, value, threshold float32) string {
+	return fmt.Sprintf("%s is %.1fx of %s ago, over %gx in %s", series, value, humanDuration(c.offset), threshold, c.env)
+}
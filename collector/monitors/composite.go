@@ -0,0 +1,28 @@
+package monitors
+
+import (
+	"fmt"
+	"hawkeye/collector/aggregator"
+)
+
+// CompositeMonitor watches a condition over the states of other monitors, like
+// "checkout_5xx and checkout_latency". The value is 1 while the condition holds,
+// collected by the aggregator passed with WithAggregateFunc.
+type CompositeMonitor struct {
+	*CounterMonitor
+	condition aggregator.Condition
+}
+
+func NewCompositeMonitor(name, env string, condition aggregator.Condition, opts ...CounterMonitorOpts) *CompositeMonitor {
+	cm := &CompositeMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+		condition:      condition,
+	}
+	cm.describe = cm.holds
+
+	return cm
+}
+
+func (c *CompositeMonitor) holds(series string, _, _ float32) string {
+	return fmt.Sprintf("%s is alerting, %s in %s", series, c.condition, c.env)
+}
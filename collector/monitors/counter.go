@@ -2,10 +2,14 @@ package monitors
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"hawkeye/collector/aggregator"
 	"hawkeye/notifiers"
+	"hawkeye/quiver"
+	"hawkeye/utils"
 	"log"
+	"sort"
 	"time"
 
 	"sync"
@@ -19,24 +23,72 @@ type CounterMonitor struct {
 	notify    notifiers.Notifier
 	env       string
 	closing   chan chan struct{}
+	grouper   aggregator.Grouper
+	describe  func(series string, value, threshold float32) string
+	// pendingFor is how long a breach has to last before it is alerting
+	pendingFor time.Duration
+	// recoverBelow is the value an alert resolves under, the threshold when not set
+	recoverBelow *float32
+	// absentFor is how long the series of a group can go unwritten before it has no data
+	absentFor time.Duration
+	lastWrite aggregator.LastWriter
+
+	// triggers are checked against the value collected once for every group
+	triggers []*trigger
+	mu       sync.RWMutex
+}
+
+// Trigger is a threshold of the monitor, with its own notifier and alert states.
+// All the triggers of a monitor are checked against the same collected value.
+type Trigger struct {
+	// Severity is the level of the trigger, like warn or critical
+	Severity     string
+	Threshold    float32
+	RecoverBelow *float32
+	PendingFor   time.Duration
+	Notifier     notifiers.Notifier
+}
+
+type trigger struct {
+	Trigger
+	states map[string]*groupState
 }
 
 type CounterMonitorOpts func(c *CounterMonitor)
 
+// NewCounterMonitor checks the triggers added with WithTrigger. Without them, the monitor
+// has a single trigger made of WithThreshold, WithNotifier, WithPendingFor and WithRecoverBelow.
 func NewCounterMonitor(name, env string, opts ...CounterMonitorOpts) *CounterMonitor {
 	cm := &CounterMonitor{
 		name:    name,
 		env:     env,
 		closing: make(chan chan struct{}),
 	}
+	cm.describe = cm.exceeded
 
 	for _, opt := range opts {
 		opt(cm)
 	}
 
+	if len(cm.triggers) == 0 {
+		WithTrigger(Trigger{
+			Threshold:    cm.threshold,
+			RecoverBelow: cm.recoverBelow,
+			PendingFor:   cm.pendingFor,
+			Notifier:     cm.notify,
+		})(cm)
+	}
+
 	return cm
 }
 
+// WithTrigger adds a trigger to the monitor, it can be used more than once for severity levels.
+func WithTrigger(t Trigger) CounterMonitorOpts {
+	return func(c *CounterMonitor) {
+		c.triggers = append(c.triggers, &trigger{Trigger: t, states: map[string]*groupState{}})
+	}
+}
+
 func WithThreshold(threshold float32) CounterMonitorOpts {
 	return func(c *CounterMonitor) {
 		c.threshold = threshold
@@ -55,12 +107,43 @@ func WithAggregateFunc(fn aggregator.Aggregator) CounterMonitorOpts {
 	}
 }
 
+// WithGrouper evaluates the threshold for every group of series separately.
+// Without it the monitor collects all the series of the metric together.
+func WithGrouper(g aggregator.Grouper) CounterMonitorOpts {
+	return func(c *CounterMonitor) {
+		c.grouper = g
+	}
+}
+
 func WithNotifier(n notifiers.Notifier) CounterMonitorOpts {
 	return func(c *CounterMonitor) {
 		c.notify = n
 	}
 }
 
+// WithRecoverBelow resolves the alert only once the value is under recoverBelow, instead of the threshold.
+func WithRecoverBelow(recoverBelow float32) CounterMonitorOpts {
+	return func(c *CounterMonitor) {
+		c.recoverBelow = &recoverBelow
+	}
+}
+
+// WithPendingFor keeps a breach pending until it lasted for the duration, before it is notified.
+func WithPendingFor(d time.Duration) CounterMonitorOpts {
+	return func(c *CounterMonitor) {
+		c.pendingFor = d
+	}
+}
+
+// WithAbsentFor moves a group to no data once its series were not written for the duration,
+// instead of checking the value, which is 0 for a metric which is not reported anymore.
+func WithAbsentFor(d time.Duration, lastWrite aggregator.LastWriter) CounterMonitorOpts {
+	return func(c *CounterMonitor) {
+		c.absentFor = d
+		c.lastWrite = lastWrite
+	}
+}
+
 func (c *CounterMonitor) Start(ctx context.Context, w *sync.WaitGroup) {
 	ticker := time.NewTicker(c.interval)
 	defer ticker.Stop()
@@ -78,20 +161,237 @@ func (c *CounterMonitor) Start(ctx context.Context, w *sync.WaitGroup) {
 			return
 
 		case <-ticker.C:
-			// log.Println("collecting ", c.name)
-			count := c.collector.Collect(ctx, c.name, c.interval)
-
-			if count >= c.threshold {
-				text := fmt.Sprintf("%s has exceeded threshold by %.3f in %s", c.name, count-c.threshold, c.env)
-				err := c.notify.Send(ctx, map[string]interface{}{"count": text})
-				if err != nil {
-					log.Println("failed to notify ", text)
-				}
+			c.tick(ctx)
+		}
+	}
+}
+
+func (c *CounterMonitor) groups(ctx context.Context) ([]quiver.Tags, error) {
+	if c.grouper == nil {
+		return []quiver.Tags{nil}, nil
+	}
+
+	return c.grouper.Groups(ctx, c.name)
+}
+
+// tick checks every group, the groups checked before which are not found anymore have no data.
+// When the groups can not be read, the tick is skipped, and the states are kept as they are.
+func (c *CounterMonitor) tick(ctx context.Context) {
+	groups, err := c.groups(ctx)
+	if err != nil {
+		log.Println("failed to get the groups of ", c.name, err)
+		return
+	}
+
+	seen := map[string]bool{}
+
+	for _, group := range groups {
+		seen[group.String()] = true
+
+		absent, err := c.absent(ctx, group)
+		if err != nil {
+			log.Println("failed to get last write of ", c.name, group, err)
+			continue
+		}
+
+		if absent {
+			for _, t := range c.triggers {
+				c.noData(ctx, t, group)
+			}
+			continue
+		}
+
+		// log.Println("collecting ", c.name, group)
+		count, err := c.collector.Collect(ctx, c.name, group, c.interval)
+		if errors.Is(err, aggregator.ErrInsufficientDenominator) {
+			// too little traffic to check the ratio, the states are kept as they are
+			continue
+		}
+
+		if err != nil {
+			// the states are kept as they are, an error is neither a 0 nor no data
+			log.Println("failed to collect ", c.name, group, err)
+			continue
+		}
+
+		for _, t := range c.triggers {
+			c.check(ctx, t, group, count)
+		}
+	}
+
+	now := utils.Now()
+
+	for _, t := range c.triggers {
+		for key, state := range c.groupStates(t) {
+			if seen[key] {
+				continue
+			}
+
+			c.mu.Lock()
+			tr, changed := state.noData(now)
+			c.mu.Unlock()
+
+			if changed {
+				c.notifyTransition(ctx, t, state, tr)
 			}
 		}
 	}
 }
 
+// absent is true when the series of the group were not written for absentFor.
+func (c *CounterMonitor) absent(ctx context.Context, group quiver.Tags) (bool, error) {
+	if c.absentFor <= 0 || c.lastWrite == nil {
+		return false, nil
+	}
+
+	at, err := c.lastWrite.LastWrite(ctx, group)
+	if err != nil {
+		return false, err
+	}
+
+	return utils.Now().Sub(at) >= c.absentFor, nil
+}
+
+func (c *CounterMonitor) check(ctx context.Context, t *trigger, group quiver.Tags, count float32) {
+	now := utils.Now()
+
+	c.mu.Lock()
+	state := t.state(group, now)
+	tr, changed := state.next(count, count >= t.Threshold, t.recovered(count), t.PendingFor, now)
+	c.mu.Unlock()
+
+	if changed {
+		c.notifyTransition(ctx, t, state, tr)
+	}
+}
+
+func (c *CounterMonitor) noData(ctx context.Context, t *trigger, group quiver.Tags) {
+	now := utils.Now()
+
+	c.mu.Lock()
+	state := t.state(group, now)
+	tr, changed := state.noData(now)
+	c.mu.Unlock()
+
+	if changed {
+		c.notifyTransition(ctx, t, state, tr)
+	}
+}
+
+// notifyTransition tells the notifier when a group starts alerting, resolves or has no data.
+// The resolved groups are resolved with the notifier, if it can resolve.
+func (c *CounterMonitor) notifyTransition(ctx context.Context, t *trigger, state *groupState, tr transition) {
+	series := quiver.SeriesKey(c.name, state.tags)
+
+	var text string
+
+	switch tr.to {
+	case notifiers.StateAlerting:
+		text = c.describe(series, state.value, t.Threshold)
+	case notifiers.StateResolved:
+		text = fmt.Sprintf("%s recovered after %s, peak %g in %s", series, humanDuration(tr.duration), tr.peak, c.env)
+	case notifiers.StateNoData:
+		text = fmt.Sprintf("%s has no data in %s", series, c.env)
+	default:
+		log.Println(series, " moved from ", tr.from, " to ", tr.to)
+		return
+	}
+
+	if t.Notifier == nil {
+		return
+	}
+
+	values := c.values(t, text, state.tags, state.value)
+	values[notifiers.ValueState] = tr.to
+	values[notifiers.ValuePreviousState] = tr.from
+	values[notifiers.ValuePeak] = tr.peak
+	values[notifiers.ValueDuration] = humanDuration(tr.duration)
+
+	var err error
+	if resolver, ok := t.Notifier.(notifiers.Resolver); ok && tr.to == notifiers.StateResolved {
+		err = resolver.Resolve(ctx, values)
+	} else {
+		err = t.Notifier.Send(ctx, values)
+	}
+
+	if err != nil {
+		log.Println("failed to notify ", text, err)
+	}
+}
+
+// state is the state of the group, a new group starts as ok.
+func (t *trigger) state(group quiver.Tags, now time.Time) *groupState {
+	key := group.String()
+
+	state, ok := t.states[key]
+	if !ok {
+		state = newGroupState(group, now)
+		t.states[key] = state
+	}
+
+	return state
+}
+
+func (t *trigger) recovered(count float32) bool {
+	if t.RecoverBelow != nil {
+		return count < *t.RecoverBelow
+	}
+
+	return count < t.Threshold
+}
+
+func (c *CounterMonitor) groupStates(t *trigger) map[string]*groupState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	states := make(map[string]*groupState, len(t.states))
+	for key, state := range t.states {
+		states[key] = state
+	}
+
+	return states
+}
+
+// States is the current state of every group checked by every trigger of the monitor.
+func (c *CounterMonitor) States() []AlertState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	states := []AlertState{}
+	for _, t := range c.triggers {
+		for _, state := range t.states {
+			alert := state.alertState(c.name, t.Threshold)
+			alert.Severity = t.Severity
+			states = append(states, alert)
+		}
+	}
+
+	sort.SliceStable(states, func(i, j int) bool {
+		if states[i].Threshold != states[j].Threshold {
+			return states[i].Threshold < states[j].Threshold
+		}
+		return states[i].Tags.String() < states[j].Tags.String()
+	})
+
+	return states
+}
+
+func (c *CounterMonitor) values(t *trigger, text string, group quiver.Tags, count float32) map[string]interface{} {
+	return map[string]interface{}{
+		notifiers.ValueCount:     text,
+		notifiers.ValueTags:      group.String(),
+		notifiers.ValueMetric:    c.name,
+		notifiers.ValueValue:     count,
+		notifiers.ValueThreshold: t.Threshold,
+		notifiers.ValueEnv:       c.env,
+		notifiers.ValueSeverity:  t.Severity,
+	}
+}
+
+func (c *CounterMonitor) exceeded(series string, count, threshold float32) string {
+	return fmt.Sprintf("%s has exceeded threshold by %.3f in %s", series, count-threshold, c.env)
+}
+
 func (c *CounterMonitor) Stop() {
 	done := make(chan struct{})
 	c.closing <- done
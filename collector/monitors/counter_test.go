@@ -0,0 +1,137 @@
+package monitors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hawkeye/collector/aggregator"
+	"hawkeye/notifiers"
+	"hawkeye/quiver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collected is an aggregator stand-in, collecting value, or failing with err.
+type collected struct {
+	value float32
+	err   error
+}
+
+func (c *collected) Collect(context.Context, string, quiver.Tags, time.Duration) (float32, error) {
+	return c.value, c.err
+}
+
+// notified is a notifier stand-in, recording the states it was sent.
+type notified struct {
+	states []notifiers.State
+}
+
+func (n *notified) Send(_ context.Context, values map[string]interface{}) error {
+	n.states = append(n.states, values[notifiers.ValueState].(notifiers.State))
+	return nil
+}
+
+// sent returns the states sent since the last call.
+func (n *notified) sent() []notifiers.State {
+	states := n.states
+	n.states = nil
+	return states
+}
+
+func TestCounterMonitorKeepsStatesOnErrors(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("%w: 3 under 20", aggregator.ErrInsufficientDenominator),
+		errors.New("connection refused"),
+	} {
+		collector := &collected{value: 0.5}
+		n := &notified{}
+
+		m := NewCounterMonitor("ratio(http.response.500, http.request)", "prod",
+			WithAggregateFunc(collector), WithThreshold(0.1), WithNotifier(n), WithInterval(time.Minute))
+
+		ctx := context.Background()
+
+		m.tick(ctx)
+		if sent := n.sent(); !reflect.DeepEqual(sent, []notifiers.State{notifiers.StateAlerting}) {
+			t.Fatalf("%v: expected the alert, got %v", err, sent)
+		}
+
+		// the dip in the traffic neither resolves the alert nor has no data
+		collector.err = err
+		m.tick(ctx)
+		m.tick(ctx)
+
+		if sent := n.sent(); len(sent) != 0 {
+			t.Errorf("%v: expected the alert to be kept, got %v", err, sent)
+		}
+
+		if states := m.States(); len(states) != 1 || states[0].State != notifiers.StateAlerting {
+			t.Errorf("%v: expected the group to be alerting, got %+v", err, states)
+		}
+
+		collector.value, collector.err = 0.01, nil
+		m.tick(ctx)
+
+		if sent := n.sent(); !reflect.DeepEqual(sent, []notifiers.State{notifiers.StateResolved}) {
+			t.Errorf("%v: expected the alert to resolve, got %v", err, sent)
+		}
+	}
+}
+
+// written is a last writer stand-in, the series were written at, or failing with err.
+type written struct {
+	at  time.Time
+	err error
+}
+
+func (w *written) LastWrite(context.Context, quiver.Tags) (time.Time, error) {
+	return w.at, w.err
+}
+
+func TestCounterMonitorAbsentFor(t *testing.T) {
+	collector := &collected{}
+	lastWrite := &written{}
+	n := &notified{}
+
+	m := NewCounterMonitor("http.response.500", "prod",
+		WithAggregateFunc(collector), WithThreshold(5), WithNotifier(n), WithInterval(time.Minute),
+		WithAbsentFor(10*time.Minute, lastWrite))
+
+	ctx := context.Background()
+
+	steps := []struct {
+		name      string
+		value     float32
+		writtenAt time.Time
+		err       error
+		sent      []notifiers.State
+		state     notifiers.State
+	}{
+		// written recently, a count of 0 is a value and not no data
+		{name: "zero", value: 0, writtenAt: time.Now(), state: notifiers.StateOK},
+		{name: "alerting", value: 7, writtenAt: time.Now(), sent: []notifiers.State{notifiers.StateAlerting}, state: notifiers.StateAlerting},
+		{name: "back to zero", value: 0, writtenAt: time.Now(), sent: []notifiers.State{notifiers.StateResolved}, state: notifiers.StateResolved},
+		{name: "alerting again", value: 9, writtenAt: time.Now().Add(-9 * time.Minute), sent: []notifiers.State{notifiers.StateAlerting}, state: notifiers.StateAlerting},
+		// not written for absent for, the 0 collected is no data
+		{name: "not written", value: 0, writtenAt: time.Now().Add(-10 * time.Minute), sent: []notifiers.State{notifiers.StateNoData}, state: notifiers.StateNoData},
+		{name: "last write failed", value: 0, err: errors.New("connection refused"), state: notifiers.StateNoData},
+		{name: "written again", value: 8, writtenAt: time.Now(), sent: []notifiers.State{notifiers.StateAlerting}, state: notifiers.StateAlerting},
+		{name: "never written", value: 0, sent: []notifiers.State{notifiers.StateNoData}, state: notifiers.StateNoData},
+	}
+
+	for _, s := range steps {
+		collector.value = s.value
+		lastWrite.at, lastWrite.err = s.writtenAt, s.err
+
+		m.tick(ctx)
+
+		if sent := n.sent(); !reflect.DeepEqual(sent, s.sent) {
+			t.Errorf("%s: expected %v to be sent, got %v", s.name, s.sent, sent)
+		}
+
+		if states := m.States(); len(states) != 1 || states[0].State != s.state {
+			t.Errorf("%s: expected the group to be %s, got %+v", s.name, s.state, states)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package monitors
+
+import (
+	"fmt"
+)
+
+// GaugeMonitor watches a gauge metric. Gauges are not summed over the interval,
+// instead the aggregation (latest, min, max or avg) decides the value which
+// is checked against the threshold. The aggregation is expected to be done by
+// the aggregator passed with WithAggregateFunc.
+type GaugeMonitor struct {
+	*CounterMonitor
+	aggregation string
+}
+
+func NewGaugeMonitor(name, env, aggregation string, opts ...CounterMonitorOpts) *GaugeMonitor {
+	gm := &GaugeMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+		aggregation:    aggregation,
+	}
+	gm.describe = gm.exceeded
+
+	return gm
+}
+
+func (g *GaugeMonitor) exceeded(series string, value, threshold float32) string {
+	return fmt.Sprintf("%s %s %.3f has exceeded threshold %.3f in %s", g.aggregation, series, value, threshold, g.env)
+}
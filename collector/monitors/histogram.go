@@ -0,0 +1,27 @@
+package monitors
+
+import (
+	"fmt"
+)
+
+// HistogramMonitor watches a percentile of a histogram metric, for example
+// the p99 latency. The percentile is expected to be computed by the
+// aggregator passed with WithAggregateFunc.
+type HistogramMonitor struct {
+	*CounterMonitor
+	percentile float64
+}
+
+func NewHistogramMonitor(name, env string, percentile float64, opts ...CounterMonitorOpts) *HistogramMonitor {
+	hm := &HistogramMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+		percentile:     percentile,
+	}
+	hm.describe = hm.exceeded
+
+	return hm
+}
+
+func (h *HistogramMonitor) exceeded(series string, value, threshold float32) string {
+	return fmt.Sprintf("p%g of %s %.3f has exceeded threshold %.3f in %s", h.percentile, series, value, threshold, h.env)
+}
@@ -0,0 +1,24 @@
+package monitors
+
+import (
+	"fmt"
+)
+
+// QueryMonitor watches the value of the query of a monitor, evaluated by the
+// aggregator passed with WithAggregateFunc.
+type QueryMonitor struct {
+	*CounterMonitor
+}
+
+func NewQueryMonitor(name, env string, opts ...CounterMonitorOpts) *QueryMonitor {
+	qm := &QueryMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+	}
+	qm.describe = qm.exceeded
+
+	return qm
+}
+
+func (q *QueryMonitor) exceeded(series string, value, threshold float32) string {
+	return fmt.Sprintf("%s is %g, over the threshold %g in %s", series, value, threshold, q.env)
+}
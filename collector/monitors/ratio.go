@@ -0,0 +1,25 @@
+package monitors
+
+import (
+	"fmt"
+)
+
+// RatioMonitor watches the ratio of two counters, like the error rate. The
+// ratio is expected to be computed by the aggregator passed with WithAggregateFunc,
+// and the thresholds are fractions, 0.02 being 2%.
+type RatioMonitor struct {
+	*CounterMonitor
+}
+
+func NewRatioMonitor(name, env string, opts ...CounterMonitorOpts) *RatioMonitor {
+	rm := &RatioMonitor{
+		CounterMonitor: NewCounterMonitor(name, env, opts...),
+	}
+	rm.describe = rm.exceeded
+
+	return rm
+}
+
+func (r *RatioMonitor) exceeded(series string, value, threshold float32) string {
+	return fmt.Sprintf("%s %.2f%% has exceeded threshold %.2f%% in %s", series, value*100, threshold*100, r.env)
+}
@@ -0,0 +1,155 @@
+package monitors
+
+import (
+	"hawkeye/notifiers"
+	"hawkeye/quiver"
+	"strings"
+	"time"
+)
+
+// AlertState is the state of the alert of a monitor, for one group of series.
+type AlertState struct {
+	Metric    string          `json:"metric"`
+	Tags      quiver.Tags     `json:"tags,omitempty"`
+	Severity  string          `json:"severity,omitempty"`
+	Threshold float32         `json:"threshold"`
+	State     notifiers.State `json:"state"`
+	// Since is when the group moved to the state.
+	Since time.Time `json:"since"`
+	// Value is the value of the last check, and Peak the highest one since the breach started.
+	Value float32 `json:"value"`
+	Peak  float32 `json:"peak,omitempty"`
+}
+
+// transition is a change of the state of a group, which the notifier is told about.
+type transition struct {
+	from     notifiers.State
+	to       notifiers.State
+	peak     float32
+	duration time.Duration
+}
+
+type groupState struct {
+	tags  quiver.Tags
+	state notifiers.State
+	since time.Time
+	value float32
+	peak  float32
+	// breachedAt is when the value went over the threshold, for the pending and alerting states
+	breachedAt time.Time
+	// open is true from the alerting notification until the resolved one, also while
+	// the group has no data in between, for the alert to be resolved or go on after it
+	open bool
+}
+
+func newGroupState(tags quiver.Tags, now time.Time) *groupState {
+	return &groupState{tags: tags, state: notifiers.StateOK, since: now}
+}
+
+// next moves the group to the state of the checked value. A breach is pending until it
+// has lasted pendingFor, only then it is alerting. Alerting goes to resolved once the value
+// has recovered, and resolved to ok on the next check. An alert which was open when the
+// group had no data goes on alerting when the data is back, or resolves.
+func (g *groupState) next(value float32, breached, recovered bool, pendingFor time.Duration, now time.Time) (transition, bool) {
+	g.value = value
+
+	to := g.state
+
+	switch {
+	case breached && (g.state == notifiers.StatePending || g.open):
+		if value > g.peak {
+			g.peak = value
+		}
+
+		if g.open {
+			to = notifiers.StateAlerting
+		} else if now.Sub(g.breachedAt) >= pendingFor {
+			to = notifiers.StateAlerting
+		}
+
+	case breached:
+		g.breachedAt = now
+		g.peak = value
+
+		to = notifiers.StateAlerting
+		if pendingFor > 0 {
+			to = notifiers.StatePending
+		}
+
+	case g.open && !recovered:
+		// under the threshold, but not enough to resolve
+		to = notifiers.StateAlerting
+
+	case g.open:
+		to = notifiers.StateResolved
+
+	default:
+		to = notifiers.StateOK
+	}
+
+	return g.move(to, now)
+}
+
+// noData moves the group to no data, when its series are not found anymore.
+func (g *groupState) noData(now time.Time) (transition, bool) {
+	return g.move(notifiers.StateNoData, now)
+}
+
+func (g *groupState) move(to notifiers.State, now time.Time) (transition, bool) {
+	if to == g.state {
+		return transition{}, false
+	}
+
+	t := transition{from: g.state, to: to, peak: g.peak}
+
+	if g.open {
+		t.duration = now.Sub(g.breachedAt)
+	}
+
+	g.state = to
+	g.since = now
+
+	switch to {
+	case notifiers.StateAlerting:
+		g.open = true
+	case notifiers.StateResolved:
+		g.open = false
+	case notifiers.StateOK:
+		g.open = false
+		g.peak = 0
+	}
+
+	return t, true
+}
+
+func (g *groupState) alertState(metric string, threshold float32) AlertState {
+	return AlertState{
+		Metric:    metric,
+		Tags:      g.tags,
+		Threshold: threshold,
+		State:     g.state,
+		Since:     g.since,
+		Value:     g.value,
+		Peak:      g.peak,
+	}
+}
+
+// humanDuration rounds the duration to what is readable in a notification, 14m or 1h5m.
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		d = d.Round(time.Second)
+	default:
+		d = d.Round(time.Minute)
+	}
+
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
@@ -0,0 +1,200 @@
+package monitors
+
+import (
+	"hawkeye/notifiers"
+	"testing"
+	"time"
+)
+
+// step is a check of the group at a minute, or a check without data, and what it
+// should move the group to. The transition is only looked at when the group moved.
+type step struct {
+	minute int
+	value  float32
+	noData bool
+
+	state    notifiers.State
+	moved    bool
+	from     notifiers.State
+	peak     float32
+	duration time.Duration
+	open     bool
+}
+
+func TestGroupStateTransitions(t *testing.T) {
+	recoverBelow := float32(6)
+
+	tests := []struct {
+		name    string
+		trigger Trigger
+		steps   []step
+	}{
+		{
+			name:    "alerting, resolved and ok",
+			trigger: Trigger{Threshold: 10},
+			steps: []step{
+				{minute: 0, value: 5, state: notifiers.StateOK},
+				{minute: 1, value: 12, state: notifiers.StateAlerting, moved: true, from: notifiers.StateOK, peak: 12, open: true},
+				// the alert goes on, the peak is the highest value since the breach
+				{minute: 2, value: 20, state: notifiers.StateAlerting, open: true},
+				{minute: 3, value: 15, state: notifiers.StateAlerting, open: true},
+				{minute: 4, value: 3, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 20, duration: 3 * time.Minute},
+				{minute: 5, value: 3, state: notifiers.StateOK, moved: true, from: notifiers.StateResolved, peak: 20},
+				{minute: 6, value: 4, state: notifiers.StateOK},
+			},
+		},
+		{
+			name:    "pending, alerting",
+			trigger: Trigger{Threshold: 10, PendingFor: 2 * time.Minute},
+			steps: []step{
+				{minute: 0, value: 11, state: notifiers.StatePending, moved: true, from: notifiers.StateOK, peak: 11},
+				{minute: 1, value: 14, state: notifiers.StatePending},
+				{minute: 2, value: 12, state: notifiers.StateAlerting, moved: true, from: notifiers.StatePending, peak: 14, open: true},
+				{minute: 3, value: 9, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 14, duration: 3 * time.Minute},
+			},
+		},
+		{
+			name:    "no data while alerting, then alerting again",
+			trigger: Trigger{Threshold: 10},
+			steps: []step{
+				{minute: 0, value: 12, state: notifiers.StateAlerting, moved: true, from: notifiers.StateOK, peak: 12, open: true},
+				// the alert stays open without data
+				{minute: 1, noData: true, state: notifiers.StateNoData, moved: true, from: notifiers.StateAlerting, peak: 12, duration: time.Minute, open: true},
+				{minute: 2, noData: true, state: notifiers.StateNoData, open: true},
+				// and goes on from the first breach, not pending again
+				{minute: 3, value: 11, state: notifiers.StateAlerting, moved: true, from: notifiers.StateNoData, peak: 12, duration: 3 * time.Minute, open: true},
+				{minute: 4, value: 2, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 12, duration: 4 * time.Minute},
+			},
+		},
+		{
+			name:    "no data while alerting, then resolved",
+			trigger: Trigger{Threshold: 10},
+			steps: []step{
+				{minute: 0, value: 12, state: notifiers.StateAlerting, moved: true, from: notifiers.StateOK, peak: 12, open: true},
+				{minute: 1, noData: true, state: notifiers.StateNoData, moved: true, from: notifiers.StateAlerting, peak: 12, duration: time.Minute, open: true},
+				{minute: 2, value: 1, state: notifiers.StateResolved, moved: true, from: notifiers.StateNoData, peak: 12, duration: 2 * time.Minute},
+			},
+		},
+		{
+			name:    "no data while ok",
+			trigger: Trigger{Threshold: 10},
+			steps: []step{
+				{minute: 0, noData: true, state: notifiers.StateNoData, moved: true, from: notifiers.StateOK},
+				{minute: 1, value: 1, state: notifiers.StateOK, moved: true, from: notifiers.StateNoData},
+			},
+		},
+		{
+			name:    "the peak is reset on ok",
+			trigger: Trigger{Threshold: 10},
+			steps: []step{
+				{minute: 0, value: 30, state: notifiers.StateAlerting, moved: true, from: notifiers.StateOK, peak: 30, open: true},
+				{minute: 1, value: 1, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 30, duration: time.Minute},
+				{minute: 2, value: 1, state: notifiers.StateOK, moved: true, from: notifiers.StateResolved, peak: 30},
+				// a new breach has its own peak and duration
+				{minute: 3, value: 11, state: notifiers.StateAlerting, moved: true, from: notifiers.StateOK, peak: 11, open: true},
+				{minute: 5, value: 1, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 11, duration: 2 * time.Minute},
+			},
+		},
+		{
+			name:    "a breach shorter than pending for",
+			trigger: Trigger{Threshold: 10, PendingFor: 3 * time.Minute},
+			steps: []step{
+				{minute: 0, value: 11, state: notifiers.StatePending, moved: true, from: notifiers.StateOK, peak: 11},
+				{minute: 2, value: 13, state: notifiers.StatePending},
+				// never alerted, so not resolved either
+				{minute: 3, value: 9, state: notifiers.StateOK, moved: true, from: notifiers.StatePending, peak: 13},
+				// the next breach is pending from its own start
+				{minute: 4, value: 12, state: notifiers.StatePending, moved: true, from: notifiers.StateOK, peak: 12},
+				{minute: 6, value: 12, state: notifiers.StatePending},
+				{minute: 7, value: 12, state: notifiers.StateAlerting, moved: true, from: notifiers.StatePending, peak: 12, open: true},
+			},
+		},
+		{
+			name:    "a breach which lasts pending for",
+			trigger: Trigger{Threshold: 10, PendingFor: 3 * time.Minute},
+			steps: []step{
+				{minute: 0, value: 10, state: notifiers.StatePending, moved: true, from: notifiers.StateOK, peak: 10},
+				{minute: 3, value: 10, state: notifiers.StateAlerting, moved: true, from: notifiers.StatePending, peak: 10, open: true},
+				{minute: 4, value: 15, state: notifiers.StateAlerting, open: true},
+				{minute: 5, value: 1, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 15, duration: 5 * time.Minute},
+			},
+		},
+		{
+			name:    "recover below",
+			trigger: Trigger{Threshold: 10, RecoverBelow: &recoverBelow},
+			steps: []step{
+				{minute: 0, value: 12, state: notifiers.StateAlerting, moved: true, from: notifiers.StateOK, peak: 12, open: true},
+				// under the threshold, but not under recover below
+				{minute: 1, value: 9, state: notifiers.StateAlerting, open: true},
+				{minute: 2, value: 6, state: notifiers.StateAlerting, open: true},
+				// back over the threshold, the alert goes on
+				{minute: 3, value: 14, state: notifiers.StateAlerting, open: true},
+				{minute: 4, value: 7, state: notifiers.StateAlerting, open: true},
+				{minute: 5, value: 5.9, state: notifiers.StateResolved, moved: true, from: notifiers.StateAlerting, peak: 14, duration: 5 * time.Minute},
+				// resolved, a value between the two is ok
+				{minute: 6, value: 8, state: notifiers.StateOK, moved: true, from: notifiers.StateResolved, peak: 14},
+			},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range tests {
+		tr := &trigger{Trigger: tt.trigger}
+		g := newGroupState(nil, start)
+
+		for i, s := range tt.steps {
+			now := start.Add(time.Duration(s.minute) * time.Minute)
+
+			var (
+				moved transition
+				ok    bool
+			)
+			if s.noData {
+				moved, ok = g.noData(now)
+			} else {
+				// as the counter monitor checks its triggers
+				moved, ok = g.next(s.value, s.value >= tr.Threshold, tr.recovered(s.value), tr.PendingFor, now)
+			}
+
+			if g.state != s.state {
+				t.Errorf("%s, step %d: expected %s, got %s", tt.name, i, s.state, g.state)
+			}
+
+			if g.open != s.open {
+				t.Errorf("%s, step %d: expected open to be %v", tt.name, i, s.open)
+			}
+
+			if ok != s.moved {
+				t.Errorf("%s, step %d: expected moved to be %v", tt.name, i, s.moved)
+				continue
+			}
+
+			if !ok {
+				continue
+			}
+
+			expected := transition{from: s.from, to: s.state, peak: s.peak, duration: s.duration}
+			if moved != expected {
+				t.Errorf("%s, step %d: expected the transition %+v, got %+v", tt.name, i, expected, moved)
+			}
+
+			if !g.since.Equal(now) {
+				t.Errorf("%s, step %d: expected the group to be in %s since %v, got %v", tt.name, i, g.state, now, g.since)
+			}
+		}
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		42*time.Second + 300*time.Millisecond: "42s",
+		14*time.Minute + 20*time.Second:       "14m",
+		65 * time.Minute:                      "1h5m",
+		2 * time.Hour:                         "2h",
+	} {
+		if s := humanDuration(d); s != expected {
+			t.Errorf("%v: expected %s, got %s", d, expected, s)
+		}
+	}
+}
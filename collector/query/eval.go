@@ -0,0 +1,220 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"hawkeye/quiver"
+	"time"
+)
+
+// ErrDivisionByZero is a query which has no value, like a ratio without requests.
+var ErrDivisionByZero = errors.New("division_by_zero")
+
+// Eval evaluates the query over the window, for the series with the tags. The tags
+// of the selectors are added over the tags, and the selectors without a range are
+// over the window. A division by 0 is ErrDivisionByZero, and not a value.
+func (q *Query) Eval(ctx context.Context, repo quiver.Repository, tags quiver.Tags, from, to time.Time) (float64, error) {
+	return q.expr.eval(ctx, &env{repo: repo, tags: tags, from: from, to: to})
+}
+
+// env is what the query is evaluated for.
+type env struct {
+	repo     quiver.Repository
+	tags     quiver.Tags
+	from, to time.Time
+}
+
+type expr interface {
+	eval(ctx context.Context, e *env) (float64, error)
+	metrics() []string
+}
+
+// function evaluates a selector over a window, from the values of one metric type.
+type function struct {
+	// quantile functions take the quantile before the selector
+	quantile bool
+	eval     func(ctx context.Context, e *env, s selector, from, to time.Time, quantile float64) (float64, error)
+}
+
+var functions = map[string]function{
+	// sum is the count of a counter, and rate its count per second
+	"sum": {eval: func(ctx context.Context, e *env, s selector, from, to time.Time, _ float64) (float64, error) {
+		count, err := e.repo.GetCountBetween(ctx, s.metric, s.filter(e), from, to)
+		return float64(count), err
+	}},
+	"rate": {eval: func(ctx context.Context, e *env, s selector, from, to time.Time, _ float64) (float64, error) {
+		count, err := e.repo.GetCountBetween(ctx, s.metric, s.filter(e), from, to)
+		return float64(count) / to.Sub(from).Seconds(), err
+	}},
+	"count_distinct": {eval: func(ctx context.Context, e *env, s selector, from, to time.Time, _ float64) (float64, error) {
+		count, err := e.repo.GetSetBetween(ctx, s.metric, s.filter(e), from, to)
+		return float64(count), err
+	}},
+	"max_over_time":  {eval: overTime(maxValue)},
+	"min_over_time":  {eval: overTime(minValue)},
+	"avg_over_time":  {eval: overTime(avgValue)},
+	"last_over_time": {eval: overTime(lastValue)},
+	"quantile_over_time": {quantile: true, eval: func(ctx context.Context, e *env, s selector, from, to time.Time, quantile float64) (float64, error) {
+		sketch, err := e.repo.GetHistogramBetween(ctx, s.metric, s.filter(e), from, to)
+		if err != nil {
+			return 0, err
+		}
+
+		return sketch.Quantile(quantile), nil
+	}},
+}
+
+// overTime reduces the gauge values of the window, which is 0 without values.
+func overTime(reduce func(values []float32) float64) func(context.Context, *env, selector, time.Time, time.Time, float64) (float64, error) {
+	return func(ctx context.Context, e *env, s selector, from, to time.Time, _ float64) (float64, error) {
+		values, err := e.repo.GetGaugeBetween(ctx, s.metric, s.filter(e), from, to)
+		if err != nil || len(values) == 0 {
+			return 0, err
+		}
+
+		return reduce(values), nil
+	}
+}
+
+func maxValue(values []float32) float64 {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v > m {
+			m = v
+		}
+	}
+
+	return float64(m)
+}
+
+func minValue(values []float32) float64 {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return float64(m)
+}
+
+func avgValue(values []float32) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+
+	return sum / float64(len(values))
+}
+
+func lastValue(values []float32) float64 {
+	return float64(values[len(values)-1])
+}
+
+type numberExpr struct {
+	value float64
+}
+
+func (n numberExpr) eval(context.Context, *env) (float64, error) {
+	return n.value, nil
+}
+
+func (n numberExpr) metrics() []string {
+	return nil
+}
+
+type parenExpr struct {
+	expr expr
+}
+
+func (p parenExpr) eval(ctx context.Context, e *env) (float64, error) {
+	return p.expr.eval(ctx, e)
+}
+
+func (p parenExpr) metrics() []string {
+	return p.expr.metrics()
+}
+
+type negExpr struct {
+	expr expr
+}
+
+func (n negExpr) eval(ctx context.Context, e *env) (float64, error) {
+	value, err := n.expr.eval(ctx, e)
+	return -value, err
+}
+
+func (n negExpr) metrics() []string {
+	return n.expr.metrics()
+}
+
+type binaryExpr struct {
+	op       string
+	lhs, rhs expr
+}
+
+func (b binaryExpr) eval(ctx context.Context, e *env) (float64, error) {
+	lhs, err := b.lhs.eval(ctx, e)
+	if err != nil {
+		return 0, err
+	}
+
+	rhs, err := b.rhs.eval(ctx, e)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.op {
+	case "+":
+		return lhs + rhs, nil
+	case "-":
+		return lhs - rhs, nil
+	case "*":
+		return lhs * rhs, nil
+	}
+
+	if rhs == 0 {
+		return 0, ErrDivisionByZero
+	}
+
+	return lhs / rhs, nil
+}
+
+func (b binaryExpr) metrics() []string {
+	return append(b.lhs.metrics(), b.rhs.metrics()...)
+}
+
+type callExpr struct {
+	fn       function
+	quantile float64
+	selector selector
+}
+
+func (c callExpr) eval(ctx context.Context, e *env) (float64, error) {
+	from, to := e.from, e.to
+	if c.selector.rng > 0 {
+		from = to.Add(-c.selector.rng)
+	}
+
+	return c.fn.eval(ctx, e, c.selector, from, to, c.quantile)
+}
+
+func (c callExpr) metrics() []string {
+	return []string{c.selector.metric}
+}
+
+// selector is the series of a metric matching the tags, over the range.
+type selector struct {
+	metric string
+	tags   quiver.Tags
+	rng    time.Duration
+}
+
+// filter is the tags of the series, the tags of the selector added over the ones evaluated for.
+func (s selector) filter(e *env) quiver.Tags {
+	if len(s.tags) == 0 {
+		return e.tags
+	}
+
+	return e.tags.Merge(s.tags)
+}
@@ -0,0 +1,166 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"hawkeye/quiver"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeRepo has the values of the metrics, whatever the tags and window,
+// and records the tags and windows they were read for.
+type fakeRepo struct {
+	quiver.Repository
+
+	counts   map[string]float32
+	gauges   map[string][]float32
+	sets     map[string]float32
+	sketches map[string]*quiver.Sketch
+
+	filters []quiver.Tags
+	windows [][2]time.Time
+}
+
+func (f *fakeRepo) read(filter quiver.Tags, from, to time.Time) {
+	f.filters = append(f.filters, filter)
+	f.windows = append(f.windows, [2]time.Time{from, to})
+}
+
+func (f *fakeRepo) GetCountBetween(_ context.Context, metric string, filter quiver.Tags, from, to time.Time) (float32, error) {
+	f.read(filter, from, to)
+	return f.counts[metric], nil
+}
+
+func (f *fakeRepo) GetGaugeBetween(_ context.Context, metric string, filter quiver.Tags, from, to time.Time) ([]float32, error) {
+	f.read(filter, from, to)
+	return f.gauges[metric], nil
+}
+
+func (f *fakeRepo) GetSetBetween(_ context.Context, metric string, filter quiver.Tags, from, to time.Time) (float32, error) {
+	f.read(filter, from, to)
+	return f.sets[metric], nil
+}
+
+func (f *fakeRepo) GetHistogramBetween(_ context.Context, metric string, filter quiver.Tags, from, to time.Time) (*quiver.Sketch, error) {
+	f.read(filter, from, to)
+	return f.sketches[metric], nil
+}
+
+var (
+	evalTo   = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	evalFrom = evalTo.Add(-time.Minute)
+)
+
+func eval(t *testing.T, repo *fakeRepo, text string, tags quiver.Tags) (float64, error) {
+	t.Helper()
+
+	q, err := Parse(text)
+	if err != nil {
+		t.Fatalf("%s: unexpected error %v", text, err)
+	}
+
+	return q.Eval(context.Background(), repo, tags, evalFrom, evalTo)
+}
+
+func TestEval(t *testing.T) {
+	latency := quiver.NewSketch(quiver.DefaultSketchAccuracy)
+	for i := 1; i <= 100; i++ {
+		latency.Add(float64(i))
+	}
+
+	repo := &fakeRepo{
+		counts:   map[string]float32{"http.request": 600, "http.response.500": 30},
+		gauges:   map[string][]float32{"cpu": {0.5, 0.9, 0.1, 0.3}},
+		sets:     map[string]float32{"users": 42},
+		sketches: map[string]*quiver.Sketch{"http.latency": latency},
+	}
+
+	tests := []struct {
+		query string
+		value float64
+	}{
+		{`sum(http.response.500[5m]) / sum(http.request[5m])`, 0.05},
+		{`rate(http.request[5m])`, 2},
+		{`rate(http.request)`, 10},
+		{`count_distinct(users)`, 42},
+		{`max_over_time(cpu)`, 0.9},
+		{`min_over_time(cpu)`, 0.1},
+		{`avg_over_time(cpu)`, 0.45},
+		{`last_over_time(cpu)`, 0.3},
+		{`max_over_time(missing)`, 0},
+		{`quantile_over_time(0.5, http.latency[5m])`, 50},
+		{`1 + 2 * 3`, 7},
+		{`(1 + 2) * 3`, 9},
+		{`8 / 4 / 2`, 1},
+		{`10 - 4 - 3`, 3},
+		{`-2 - -3`, 1},
+		{`1e3 / 10`, 100},
+	}
+
+	for _, tt := range tests {
+		value, err := eval(t, repo, tt.query, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.query, err)
+			continue
+		}
+
+		// the quantiles are within the accuracy of the sketch
+		if math.Abs(value-tt.value) > 0.01*math.Max(1, tt.value) {
+			t.Errorf("%s: expected %g, got %g", tt.query, tt.value, value)
+		}
+	}
+}
+
+func TestEvalDivisionByZero(t *testing.T) {
+	repo := &fakeRepo{counts: map[string]float32{"http.response.500": 3}}
+
+	_, err := eval(t, repo, `sum(http.response.500) / sum(http.request)`, nil)
+	if !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("expected ErrDivisionByZero, got %v", err)
+	}
+}
+
+func TestEvalSelectorTags(t *testing.T) {
+	repo := &fakeRepo{counts: map[string]float32{"http.request": 1}}
+	group := quiver.Tags{"route": "/pay", "env": "prod"}
+
+	if _, err := eval(t, repo, `sum(http.request) + sum(http.request{method="POST"}) + sum(http.request{route="/refund"})`, group); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []quiver.Tags{
+		{"route": "/pay", "env": "prod"},
+		{"route": "/pay", "env": "prod", "method": "POST"},
+		// the tags of the selector take precedence over the ones of the group
+		{"route": "/refund", "env": "prod"},
+	}
+
+	if !reflect.DeepEqual(repo.filters, expected) {
+		t.Errorf("expected the filters %v, got %v", expected, repo.filters)
+	}
+
+	if group["method"] != "" || group["route"] != "/pay" {
+		t.Errorf("expected the group tags to be left as they are, got %v", group)
+	}
+}
+
+func TestEvalRanges(t *testing.T) {
+	repo := &fakeRepo{counts: map[string]float32{"http.request": 1}}
+
+	if _, err := eval(t, repo, `sum(http.request[1h]) + sum(http.request)`, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := [][2]time.Time{
+		{evalTo.Add(-time.Hour), evalTo},
+		// without a range, the selector is over the window
+		{evalFrom, evalTo},
+	}
+
+	if !reflect.DeepEqual(repo.windows, expected) {
+		t.Errorf("expected the windows %v, got %v", expected, repo.windows)
+	}
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenPunct
+)
+
+// token is a lexed part of the query, pos is its offset in the query.
+type token struct {
+	kind  tokenKind
+	text  string
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits the query in tokens. Metric names are identifiers with dots, like
+// http.response.500, numbers can have an exponent, like 1e3, and durations are
+// numbers with a unit, like 5m or 1h30m.
+func lex(query string) ([]token, error) {
+	tokens := []token{}
+
+	for pos := 0; pos < len(query); {
+		c := query[pos]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+
+		case isIdentStart(c):
+			end := pos + 1
+			for end < len(query) && isIdentPart(query[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: query[pos:end], value: query[pos:end], pos: pos})
+			pos = end
+
+		case isDigit(c):
+			end := pos + 1
+			for end < len(query) && (isDigit(query[end]) || query[end] == '.') {
+				end++
+			}
+			end = exponent(query, end)
+
+			kind := tokenNumber
+			for end < len(query) && (isLetter(query[end]) || isDigit(query[end])) {
+				kind = tokenDuration
+				end++
+			}
+			tokens = append(tokens, token{kind: kind, text: query[pos:end], value: query[pos:end], pos: pos})
+			pos = end
+
+		case c == '"':
+			end := pos + 1
+			for end < len(query) && query[end] != '"' {
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+
+			if end >= len(query) {
+				return nil, syntaxError(pos, "unterminated string")
+			}
+
+			value, err := strconv.Unquote(query[pos : end+1])
+			if err != nil {
+				return nil, syntaxError(pos, "invalid string %s", query[pos:end+1])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: query[pos : end+1], value: value, pos: pos})
+			pos = end + 1
+
+		case strings.IndexByte("(){}[],=+-*/", c) >= 0:
+			// =~ and == are lexed as a single token, for the error to name them
+			end := pos + 1
+			if c == '=' && end < len(query) && (query[end] == '=' || query[end] == '~') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: query[pos:end], value: query[pos:end], pos: pos})
+			pos = end
+
+		case c == '!':
+			end := pos + 1
+			if end < len(query) && (query[end] == '=' || query[end] == '~') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: query[pos:end], value: query[pos:end], pos: pos})
+			pos = end
+
+		default:
+			return nil, syntaxError(pos, "unexpected %q", c)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(query)}), nil
+}
+
+// exponent is the end of the exponent of a number, like e3 or e-3 in 1e3 and 1e-3,
+// which starts at end, or end when there is none. e is not a unit of a duration.
+func exponent(query string, end int) int {
+	if end >= len(query) || (query[end] != 'e' && query[end] != 'E') {
+		return end
+	}
+
+	digits := end + 1
+	if digits < len(query) && (query[digits] == '+' || query[digits] == '-') {
+		digits++
+	}
+
+	if digits >= len(query) || !isDigit(query[digits]) {
+		return end
+	}
+
+	for digits < len(query) && isDigit(query[digits]) {
+		digits++
+	}
+
+	return digits
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return isLetter(c) || c == '_'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.'
+}
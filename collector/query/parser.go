@@ -0,0 +1,312 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"hawkeye/quiver"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSyntax = errors.New("query_syntax_error")
+
+// SyntaxError is a query which does not parse, Column is where in the query, from 1.
+type SyntaxError struct {
+	Column int
+	Msg    string
+}
+
+func syntaxError(pos int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Column: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Column)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrSyntax
+}
+
+// Query is a parsed query, like sum(http.response.500{route="/pay"}[5m]) / sum(http.request[5m]).
+type Query struct {
+	text string
+	expr expr
+}
+
+// Parse parses the query. Its errors are SyntaxErrors, telling what is wrong and where.
+//
+// A query is arithmetic (+, -, *, / and parentheses) over numbers and functions
+// of a selector. A selector is a metric, with tag filters and a range, like
+// http.request{route="/pay"}[5m]. Without a range, the selector is over the
+// window the query is evaluated for, the interval of the monitor.
+func Parse(text string) (*Query, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, syntaxError(next.pos, "unexpected %s", next)
+	}
+
+	return &Query{text: strings.TrimSpace(text), expr: e}, nil
+}
+
+func (q *Query) String() string {
+	return q.text
+}
+
+// Metrics are the metrics of the selectors of the query, in the order of the query.
+func (q *Query) Metrics() []string {
+	return q.expr.metrics()
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) accept(punct string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == punct {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.accept(punct) {
+		return syntaxError(p.peek().pos, "expected %q, found %s", punct, p.peek())
+	}
+
+	return nil
+}
+
+// expr is the sums of the query, * and / binding tighter than + and -.
+func (p *parser) expr() (expr, error) {
+	lhs, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokenPunct || (op != "+" && op != "-") {
+			return lhs, nil
+		}
+		p.next()
+
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		lhs = binaryExpr{op: op, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *parser) term() (expr, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokenPunct || (op != "*" && op != "/") {
+			return lhs, nil
+		}
+		p.next()
+
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = binaryExpr{op: op, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.accept("-") {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return negExpr{expr: e}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.peek()
+
+	switch {
+	case t.kind == tokenNumber:
+		p.next()
+		value, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, syntaxError(t.pos, "invalid number %s", t)
+		}
+
+		return numberExpr{value: value}, nil
+
+	case t.kind == tokenPunct && t.text == "(":
+		p.next()
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+
+		return parenExpr{expr: e}, nil
+
+	case t.kind == tokenIdent && p.tokens[p.pos+1].text == "(":
+		return p.call()
+
+	case t.kind == tokenIdent:
+		return nil, syntaxError(t.pos, "metric %s needs a function, like sum(%s[5m])", t.value, t.value)
+	}
+
+	return nil, syntaxError(t.pos, "unexpected %s, expected a number, a function or (", t)
+}
+
+// call is a function of a selector, the quantile functions taking the quantile first.
+func (p *parser) call() (expr, error) {
+	name := p.next()
+	p.next()
+
+	fn, ok := functions[name.value]
+	if !ok {
+		return nil, syntaxError(name.pos, "unknown function %s, expected one of %s", name.value, strings.Join(functionNames(), ", "))
+	}
+
+	c := callExpr{fn: fn}
+
+	if fn.quantile {
+		t := p.next()
+		if t.kind != tokenNumber {
+			return nil, syntaxError(t.pos, "%s takes the quantile first, like %s(0.99, http.latency[5m])", name.value, name.value)
+		}
+
+		q, err := strconv.ParseFloat(t.value, 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, syntaxError(t.pos, "quantile %s should be between 0 and 1", t.value)
+		}
+		c.quantile = q
+
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+	c.selector = s
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// selector is a metric, with optional tag filters and range, like http.request{route="/pay"}[5m].
+func (p *parser) selector() (selector, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return selector{}, syntaxError(t.pos, "expected a metric, found %s", t)
+	}
+
+	s := selector{metric: t.value}
+
+	if p.accept("{") {
+		s.tags = quiver.Tags{}
+
+		for !p.accept("}") {
+			key := p.next()
+			if key.kind != tokenIdent {
+				return selector{}, syntaxError(key.pos, "expected a tag name, found %s", key)
+			}
+
+			if op := p.peek(); op.kind == tokenPunct && op.text != "=" && op.text != "," && op.text != "}" {
+				return selector{}, syntaxError(op.pos, "unsupported tag matcher %s, only = is supported", op)
+			}
+
+			if err := p.expect("="); err != nil {
+				return selector{}, err
+			}
+
+			value := p.next()
+			if value.kind != tokenString {
+				return selector{}, syntaxError(value.pos, "expected a quoted tag value, found %s", value)
+			}
+			s.tags[key.value] = value.value
+
+			if !p.accept(",") {
+				if err := p.expect("}"); err != nil {
+					return selector{}, err
+				}
+				break
+			}
+		}
+	}
+
+	if p.accept("[") {
+		t := p.next()
+		if t.kind != tokenDuration {
+			return selector{}, syntaxError(t.pos, "expected a range like 5m, found %s", t)
+		}
+
+		d, err := time.ParseDuration(t.value)
+		if err != nil || d <= 0 {
+			return selector{}, syntaxError(t.pos, "invalid range %s, expected a duration like 30s, 5m or 1h", t.value)
+		}
+		s.rng = d
+
+		if err := p.expect("]"); err != nil {
+			return selector{}, err
+		}
+	}
+
+	return s, nil
+}
+
+func functionNames() []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
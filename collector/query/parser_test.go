@@ -0,0 +1,116 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query   string
+		metrics []string
+	}{
+		{`sum(http.response.500{route="/pay"}[5m]) / sum(http.request[5m])`, []string{"http.response.500", "http.request"}},
+		{`rate(http.request[1m]) * 60`, []string{"http.request"}},
+		{`1e3 * sum(http.request[1m]) + 2.5e-1`, []string{"http.request"}},
+		{`-(max_over_time(cpu[5m]) - min_over_time(cpu[5m]))`, []string{"cpu", "cpu"}},
+		{`quantile_over_time(0.99, http.latency{route="/pay", method="POST"}[1h30m])`, []string{"http.latency"}},
+		{`count_distinct(users)`, []string{"users"}},
+		{`avg_over_time(cpu{host="a",}[30s])`, []string{"cpu"}},
+		{"  last_over_time(queue.depth)\n", []string{"queue.depth"}},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.query, err)
+			continue
+		}
+
+		if got := q.Metrics(); !reflect.DeepEqual(got, tt.metrics) {
+			t.Errorf("%s: expected metrics %v, got %v", tt.query, tt.metrics, got)
+		}
+
+		if q.String() != strings.TrimSpace(tt.query) {
+			t.Errorf("%s: expected the query back, got %s", tt.query, q)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		column int
+		msg    string
+	}{
+		{``, 1, "unexpected end of query"},
+		{`http.request`, 1, "needs a function"},
+		{`foo(http.request[5m])`, 1, "unknown function foo"},
+		{`sum(http.request[5m]`, 21, `expected ")"`},
+		{`sum(http.request[5m]))`, 22, `unexpected ")"`},
+		{`sum(http.request[5m]) $ 2`, 23, "unexpected '$'"},
+		{`sum(http.request{route=~"/pay"}[5m])`, 23, "unsupported tag matcher"},
+		{`sum(http.request{route!="/pay"}[5m])`, 23, "unsupported tag matcher"},
+		{`sum(http.request{route=/pay}[5m])`, 24, "expected a quoted tag value"},
+		{`sum(http.request{route="/pay})`, 24, "unterminated string"},
+		{`sum(http.request[5x])`, 18, "invalid range 5x"},
+		{`sum(http.request[1e3])`, 18, "expected a range"},
+		{`sum(http.request[5m)`, 20, `expected "]"`},
+		{`quantile_over_time(http.latency[5m], 0.99)`, 20, "takes the quantile first"},
+		{`quantile_over_time(1.5, http.latency[5m])`, 20, "between 0 and 1"},
+		{`sum(5m)`, 5, "expected a metric"},
+		{`sum(a[5m]) +`, 13, "unexpected end of query"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("%s: expected a syntax error, got %v", tt.query, err)
+			continue
+		}
+
+		if !errors.Is(err, ErrSyntax) {
+			t.Errorf("%s: expected %v to be ErrSyntax", tt.query, err)
+		}
+
+		if serr.Column != tt.column {
+			t.Errorf("%s: expected the error at column %d, got %d (%v)", tt.query, tt.column, serr.Column, err)
+		}
+
+		if !strings.Contains(serr.Msg, tt.msg) {
+			t.Errorf("%s: expected the error to contain %q, got %q", tt.query, tt.msg, serr.Msg)
+		}
+	}
+}
+
+func TestLexNumbers(t *testing.T) {
+	tests := []struct {
+		text string
+		kind tokenKind
+	}{
+		{"1", tokenNumber},
+		{"0.5", tokenNumber},
+		{"1e3", tokenNumber},
+		{"1E+3", tokenNumber},
+		{"2.5e-1", tokenNumber},
+		{"5m", tokenDuration},
+		{"1h30m", tokenDuration},
+		{"100ms", tokenDuration},
+	}
+
+	for _, tt := range tests {
+		tokens, err := lex(tt.text)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.text, err)
+			continue
+		}
+
+		if len(tokens) != 2 || tokens[0].kind != tt.kind || tokens[0].text != tt.text {
+			t.Errorf("%s: expected a single token of kind %d, got %+v", tt.text, tt.kind, tokens)
+		}
+	}
+}
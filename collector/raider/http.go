@@ -0,0 +1,278 @@
+package raider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hawkeye/collector/aggregator"
+	"hawkeye/protocols"
+	"hawkeye/quiver"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The http api, for services which can not speak jsonrpc over the unix socket
+// POST /v1/metrics
+//		text/plain: datagram lines, the same as udp and tcp
+//		application/json: {"metrics": [{"name": "http.response.500", "value": 1, "type": "c", "tags": {"route": "/pay"}}]}
+// GET /v1/query?metric=http.response.500&window=5m&agg=sum&tags=route:/pay&group_by=route
+// GET /v1/states, when the monitors run along, see StatesHandler
+
+const (
+	DefaultQueryWindow = time.Minute
+	MaxRequestBodySize = 1 << 20
+)
+
+type JSONMetric struct {
+	Name       string            `json:"name"`
+	Value      float32           `json:"value"`
+	Member     string            `json:"member,omitempty"`
+	Type       string            `json:"type"`
+	SampleRate float64           `json:"sample_rate,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Timestamp  int64             `json:"timestamp,omitempty"`
+}
+
+type JSONBatch struct {
+	Metrics []JSONMetric `json:"metrics"`
+}
+
+type QueryGroup struct {
+	Tags  quiver.Tags `json:"tags"`
+	Value float32     `json:"value"`
+}
+
+type QueryResult struct {
+	Metric string       `json:"metric"`
+	Window string       `json:"window"`
+	Agg    string       `json:"agg"`
+	Tags   quiver.Tags  `json:"tags,omitempty"`
+	Value  *float32     `json:"value,omitempty"`
+	Groups []QueryGroup `json:"groups,omitempty"`
+}
+
+var (
+	ErrMissingMetricName = errors.New("missing_metric_name")
+	ErrInvalidWindow     = errors.New("invalid_window")
+)
+
+type HTTPHandler struct {
+	handler *Metric
+	repo    quiver.Repository
+	mux     *http.ServeMux
+}
+
+func NewHTTPHandler(handler *Metric, repo quiver.Repository) *HTTPHandler {
+	h := &HTTPHandler{handler: handler, repo: repo, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("/v1/metrics", h.PostMetrics)
+	h.mux.HandleFunc("/v1/query", h.Query)
+
+	return h
+}
+
+// HandleStates serves the alert states of the monitors running along the server.
+func (h *HTTPHandler) HandleStates(states StatesFunc) *HTTPHandler {
+	h.mux.Handle("/v1/states", StatesHandler(states))
+	return h
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *HTTPHandler) PostMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method_not_allowed"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	var packet protocols.Packet
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		packet, err = parseJSONBatch(body)
+	} else {
+		packet, err = protocols.ParsePacket(ctx, string(body))
+	}
+
+	if err != nil && packet.IsEmpty() {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the collector outlives the request, so the request context is not passed on
+	h.handler.collect(context.Background(), packet)
+
+	response := map[string]interface{}{"accepted": len(packet.Metrics) + len(packet.ServiceChecks) + len(packet.Events)}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+func parseJSONBatch(body []byte) (protocols.Packet, error) {
+	var (
+		batch  JSONBatch
+		packet protocols.Packet
+	)
+
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return packet, err
+	}
+
+	var firstErr error
+
+	for _, jm := range batch.Metrics {
+		m, err := jm.Metric()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		packet.Metrics = append(packet.Metrics, m)
+	}
+
+	return packet, firstErr
+}
+
+func (jm JSONMetric) Metric() (protocols.Metric, error) {
+	if jm.Name == "" {
+		return protocols.Metric{}, ErrMissingMetricName
+	}
+
+	mType, err := protocols.ParseMetricType(jm.Type)
+	if err != nil {
+		return protocols.Metric{}, err
+	}
+
+	sampleRate := jm.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+
+	if sampleRate < 0 || sampleRate > 1 {
+		return protocols.Metric{}, protocols.ErrInvalidSampleRate
+	}
+
+	return protocols.Metric{
+		Name:   jm.Name,
+		Value:  jm.Value,
+		Member: jm.Member,
+		Type:   mType,
+		ExtraData: protocols.ExtraData{
+			SampleRate: sampleRate,
+			TagList:    jm.Tags,
+			Timestamp:  jm.Timestamp,
+		},
+	}, nil
+}
+
+func (h *HTTPHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method_not_allowed"))
+		return
+	}
+
+	params := r.URL.Query()
+
+	metric := params.Get("metric")
+	if metric == "" {
+		writeError(w, http.StatusBadRequest, ErrMissingMetricName)
+		return
+	}
+
+	window := DefaultQueryWindow
+	if params.Get("window") != "" {
+		var err error
+		window, err = time.ParseDuration(params.Get("window"))
+		if err != nil || window <= 0 {
+			writeError(w, http.StatusBadRequest, ErrInvalidWindow)
+			return
+		}
+	}
+
+	agg := params.Get("agg")
+	if agg == "" {
+		agg = aggregator.AggregationSum
+	}
+
+	collector, err := aggregator.New(h.repo, agg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tags := quiver.ParseTags(params.Get("tags"))
+
+	result := QueryResult{
+		Metric: metric,
+		Window: window.String(),
+		Agg:    agg,
+		Tags:   tags,
+	}
+
+	ctx := r.Context()
+
+	groupBy := params.Get("group_by")
+	if groupBy == "" {
+		value, err := collector.Collect(ctx, metric, tags, window)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		result.Value = &value
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	grouper := aggregator.NewTagGrouper(h.repo, tags, strings.Split(groupBy, ","))
+
+	groups, err := grouper.Groups(ctx, metric)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result.Groups = []QueryGroup{}
+	for _, group := range groups {
+		value, err := collector.Collect(ctx, metric, group, window)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		result.Groups = append(result.Groups, QueryGroup{Tags: group, Value: value})
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("failed to write response ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
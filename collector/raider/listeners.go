@@ -0,0 +1,66 @@
+package raider
+
+import (
+	"bufio"
+	"context"
+	"hawkeye/protocols"
+	"log"
+	"net"
+)
+
+// MaxPacketSize is the largest udp packet, and the longest tcp line, that is read.
+const MaxPacketSize = 65535
+
+// ServeUDP reads datagram text from the connection until it is closed.
+// It is fire and forget, invalid metrics are only logged.
+func ServeUDP(ctx context.Context, conn net.PacketConn, handler *Metric) {
+	buf := make([]byte, MaxPacketSize)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Println("udp listener stopped ", err)
+			return
+		}
+
+		handler.handleText(ctx, string(buf[:n]))
+	}
+}
+
+// ServeTCP accepts connections until the listener is closed, and reads
+// new line delimited datagram text from each connection.
+func ServeTCP(ctx context.Context, listener net.Listener, handler *Metric) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("tcp listener stopped ", err)
+			return
+		}
+
+		go serveTCPConn(ctx, conn, handler)
+	}
+}
+
+func serveTCPConn(ctx context.Context, conn net.Conn, handler *Metric) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), MaxPacketSize)
+
+	for scanner.Scan() {
+		handler.handleText(ctx, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println("failed to read from tcp connection ", conn.RemoteAddr(), err)
+	}
+}
+
+func (m *Metric) handleText(ctx context.Context, text string) {
+	packet, err := protocols.ParsePacket(ctx, text)
+	if err != nil {
+		log.Println("invalid metric", text, err)
+	}
+
+	m.collect(ctx, packet)
+}
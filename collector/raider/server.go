@@ -10,6 +10,7 @@ import (
 	"hawkeye/utils"
 	"log"
 	"net"
+	"net/http"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"os"
@@ -31,10 +32,50 @@ type MetricServer struct {
 	Protocol   string
 	Socketfile string
 	RedisHost  string
+	UDPAddr    string
+	TCPAddr    string
+	HTTPAddr   string
 	listener   net.Listener
+	udpConn    net.PacketConn
+	tcpConn    net.Listener
+	httpConn   net.Listener
+	httpServer *http.Server
+	states     StatesFunc
 }
 
-func NewMetricServer(redisHost string) MetricServer {
+type MetricServerOpts func(m *MetricServer)
+
+// WithUDP listens for datagram text on the udp address as well, statsd style.
+// Each udp packet can have multiple metrics separated by new lines.
+func WithUDP(addr string) MetricServerOpts {
+	return func(m *MetricServer) {
+		m.UDPAddr = addr
+	}
+}
+
+// WithTCP listens for new line delimited datagram text on the tcp address as well.
+func WithTCP(addr string) MetricServerOpts {
+	return func(m *MetricServer) {
+		m.TCPAddr = addr
+	}
+}
+
+// WithHTTP serves the http ingestion and query api on the address as well.
+func WithHTTP(addr string) MetricServerOpts {
+	return func(m *MetricServer) {
+		m.HTTPAddr = addr
+	}
+}
+
+// WithAlertStates serves the alert states of the monitors running along the server
+// on the http api, at /v1/states.
+func WithAlertStates(states StatesFunc) MetricServerOpts {
+	return func(m *MetricServer) {
+		m.states = states
+	}
+}
+
+func NewMetricServer(redisHost string, opts ...MetricServerOpts) MetricServer {
 	Cleanup()
 
 	socket, err := net.Listen(utils.UnixProtocol, utils.SocketFile)
@@ -42,16 +83,45 @@ func NewMetricServer(redisHost string) MetricServer {
 		log.Fatal("failed to connect to uds ", err)
 	}
 
-	return MetricServer{
+	server := MetricServer{
 		Protocol:   utils.UnixProtocol,
 		Socketfile: utils.SocketFile,
 		listener:   socket,
 		RedisHost:  redisHost,
 	}
+
+	for _, opt := range opts {
+		opt(&server)
+	}
+
+	if server.UDPAddr != "" {
+		server.udpConn, err = net.ListenPacket("udp", server.UDPAddr)
+		if err != nil {
+			log.Fatal("failed to listen on udp ", server.UDPAddr, " ", err)
+		}
+	}
+
+	if server.TCPAddr != "" {
+		server.tcpConn, err = net.Listen("tcp", server.TCPAddr)
+		if err != nil {
+			log.Fatal("failed to listen on tcp ", server.TCPAddr, " ", err)
+		}
+	}
+
+	if server.HTTPAddr != "" {
+		server.httpConn, err = net.Listen("tcp", server.HTTPAddr)
+		if err != nil {
+			log.Fatal("failed to listen on http ", server.HTTPAddr, " ", err)
+		}
+	}
+
+	return server
 }
 
 func (m MetricServer) Start(ctx context.Context, closing, done chan struct{}) {
-	err := RegisterHandler(database.NewRedisClient(m.RedisHost))
+	client := database.NewRedisClient(m.RedisHost)
+
+	handler, err := RegisterHandler(client)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -59,24 +129,66 @@ func (m MetricServer) Start(ctx context.Context, closing, done chan struct{}) {
 	defer Cleanup()
 	listener := m.listener
 
-	for {
+	if m.udpConn != nil {
+		log.Println("listening for udp at", m.UDPAddr)
+		go ServeUDP(ctx, m.udpConn, handler)
+	}
+
+	if m.tcpConn != nil {
+		log.Println("listening for tcp at", m.TCPAddr)
+		go ServeTCP(ctx, m.tcpConn, handler)
+	}
+
+	if m.httpConn != nil {
+		log.Println("listening for http at", m.HTTPAddr)
+		httpHandler := NewHTTPHandler(handler, quiver.NewRedisRepo(client))
+		if m.states != nil {
+			httpHandler.HandleStates(m.states)
+		}
+		m.httpServer = &http.Server{Handler: httpHandler}
+
+		go func() {
+			if err := m.httpServer.Serve(m.httpConn); err != nil && err != http.ErrServerClosed {
+				log.Println("http listener stopped ", err)
+			}
+		}()
+	}
+
+	go func() {
 		select {
 		case <-closing:
 			log.Println("closing listener")
-			listener.Close()
+			m.close()
 			done <- struct{}{}
-			return
 		case <-ctx.Done():
 			log.Println("closing listener because context completed")
+			m.close()
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println(err)
 			return
-		default:
-			conn, err := listener.Accept()
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			go jsonrpc.ServeConn(conn)
 		}
+		go jsonrpc.ServeConn(conn)
+	}
+}
+
+func (m MetricServer) close() {
+	m.listener.Close()
+
+	if m.udpConn != nil {
+		m.udpConn.Close()
+	}
+
+	if m.tcpConn != nil {
+		m.tcpConn.Close()
+	}
+
+	if m.httpServer != nil {
+		m.httpServer.Close()
 	}
 }
 
@@ -87,13 +199,12 @@ func Cleanup() {
 	}
 }
 
-func RegisterHandler(client *redis.Client) error {
+func RegisterHandler(client *redis.Client) (*Metric, error) {
 	handler := &Metric{
 		collector: agents.NewMetricCollector(quiver.NewRedisRepo(client)),
 	}
-	rpc.Register(handler)
 
-	return nil
+	return handler, rpc.Register(handler)
 }
 
 type Metric struct {
@@ -111,15 +222,75 @@ func (m *Metric) Handle(args *Metric, reply *int) error {
 
 	ctx := context.Background()
 
-	metric, err := protocols.ParseDatagram(ctx, args.Text)
+	packet, err := protocols.ParsePacket(ctx, args.Text)
 	if err != nil {
-		log.Println("invalid metric", args.Text)
+		log.Println("invalid metric", args.Text, err)
+	}
+
+	if packet.IsEmpty() {
 		*reply = 1
 		return ErrFailedMetricPush
 	}
 
 	*reply = 0
 	// log.Println("sending metric", args.Text)
-	m.collector.Send(ctx, metric)
+	m.collect(ctx, packet)
 	return nil
 }
+
+type MetricBatch struct {
+	Texts []string
+}
+
+// HandleBatch handles many datagrams in one call, the reply is the number of
+// datagrams which were invalid. It fails only if none of them were valid.
+func (m *Metric) HandleBatch(args *MetricBatch, reply *int) error {
+	if args == nil || len(args.Texts) == 0 {
+		*reply = 0
+		return nil
+	}
+
+	ctx := context.Background()
+
+	var (
+		packet  protocols.Packet
+		invalid int
+	)
+
+	for _, text := range args.Texts {
+		p, err := protocols.ParsePacket(ctx, text)
+		if err != nil {
+			log.Println("invalid metric", text, err)
+			invalid++
+		}
+
+		packet.Metrics = append(packet.Metrics, p.Metrics...)
+		packet.Events = append(packet.Events, p.Events...)
+		packet.ServiceChecks = append(packet.ServiceChecks, p.ServiceChecks...)
+	}
+
+	*reply = invalid
+
+	if packet.IsEmpty() {
+		return ErrFailedMetricPush
+	}
+
+	m.collect(ctx, packet)
+	return nil
+}
+
+// collect sends the metrics and service checks of the packet to the collector.
+// Service checks are stored as a gauge of their status. Events are only logged.
+func (m *Metric) collect(ctx context.Context, packet protocols.Packet) {
+	for _, metric := range packet.Metrics {
+		m.collector.Send(ctx, metric)
+	}
+
+	for _, sc := range packet.ServiceChecks {
+		m.collector.Send(ctx, sc.Metric())
+	}
+
+	for _, event := range packet.Events {
+		log.Printf("event received %q %q alert_type=%s tags=%v\n", event.Title, event.Text, event.AlertType, event.Tags)
+	}
+}
@@ -0,0 +1,40 @@
+package raider
+
+import (
+	"errors"
+	"hawkeye/collector/monitors"
+	"hawkeye/notifiers"
+	"net/http"
+)
+
+// GET /v1/states?state=ALERTING&metric=http.response.500
+//		the alert state of every group of every trigger of the running monitors
+
+// StatesFunc is the alert states of the running monitors, like MonitoringAgent.States.
+type StatesFunc func() []monitors.AlertState
+
+type StatesResult struct {
+	States []monitors.AlertState `json:"states"`
+}
+
+// StatesHandler serves the alert states, filtered by the state and metric params when they are set.
+func StatesHandler(states StatesFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method_not_allowed"))
+			return
+		}
+
+		params := r.URL.Query()
+		state, metric := notifiers.State(params.Get("state")), params.Get("metric")
+
+		result := StatesResult{States: []monitors.AlertState{}}
+		for _, s := range states() {
+			if (state == "" || s.State == state) && (metric == "" || s.Metric == metric) {
+				result.States = append(result.States, s)
+			}
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
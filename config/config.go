@@ -34,6 +34,20 @@ type AppConfig struct {
 	MonitorConfigFile        string `mapstructure:"monitor_config_file"`
 	Environment              string `mapstricture:"environment"`
 	ServiceName              string `mapstructure:"service_name"`
+	UDPAddr                  string `mapstructure:"udp_addr"`
+	TCPAddr                  string `mapstructure:"tcp_addr"`
+	HTTPAddr                 string `mapstructure:"http_addr"`
+	SMTPHost                 string `mapstructure:"smtp_host"`
+	SMTPPort                 int    `mapstructure:"smtp_port"`
+	SMTPUsername             string `mapstructure:"smtp_username"`
+	SMTPPassword             string `mapstructure:"smtp_password"`
+	SMTPAuth                 string `mapstructure:"smtp_auth"`
+	SMTPTLS                  string `mapstructure:"smtp_tls"`
+	SMTPSender               string `mapstructure:"smtp_sender"`
+	NotifyThrottle           string `mapstructure:"notify_throttle"`
+	LeaderElection           string `mapstructure:"leader_election"`
+	LeaseTTLSeconds          int    `mapstructure:"lease_ttl"`
+	AgentHTTPAddr            string `mapstructure:"agent_http_addr"`
 }
 
 var (
@@ -153,6 +167,13 @@ func ResolveSSMParams(cfg AppConfig) AppConfig {
 		c.NotificationServiceURL = fromSSM(cfg.NotificationServiceURL)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		c.SMTPPassword = fromSSM(cfg.SMTPPassword)
+	}()
+
 	wg.Wait()
 
 	return c
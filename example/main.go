@@ -17,12 +17,18 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func StartCollector(cfg config.AppConfig, done chan struct{}) {
+func StartCollector(cfg config.AppConfig, done chan struct{}, states raider.StatesFunc) {
 	log.Print("starting collector")
 	closing := make(chan struct{}, 1)
 
 	ctx := context.Background()
-	server := raider.NewMetricServer(cfg.RedisHost)
+	server := raider.NewMetricServer(
+		cfg.RedisHost,
+		raider.WithUDP(cfg.UDPAddr),
+		raider.WithTCP(cfg.TCPAddr),
+		raider.WithHTTP(cfg.HTTPAddr),
+		raider.WithAlertStates(states),
+	)
 	go server.Start(ctx, closing, done)
 
 	go func() {
@@ -38,14 +44,13 @@ func StartCollector(cfg config.AppConfig, done chan struct{}) {
 	}()
 }
 
-func StartMonitor(cfg config.AppConfig, done chan struct{}) {
+func StartMonitor(cfg config.AppConfig, agent agents.MonitoringAgent, done chan struct{}) {
 	log.Println("starting monitor")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	monitors := aggregator.ReadMonitoringConfig(cfg.MonitorConfigFile, cfg.ServiceName)
+	monitors := aggregator.ReadMonitoringConfig(cfg.MonitorConfigFile, cfg.ServiceName, agent.NotifierNames()...)
 
-	agent := agents.NewRedisMonitoringAgent(cfg, notifiers.MockMailingService{})
 	go agent.Start(ctx, monitors...)
 
 	for {
@@ -61,13 +66,19 @@ func StartMonitor(cfg config.AppConfig, done chan struct{}) {
 func main() {
 	cfg := config.ReadConfig()
 
+	// the collector serves the alert states of the agent on its http api
+	agent := agents.NewRedisMonitoringAgent(cfg, notifiers.MockMailingService{})
+
 	cc := make(chan struct{}, 1)
-	StartCollector(cfg, cc)
+	StartCollector(cfg, cc, agent.States)
 
 	cm := make(chan struct{}, 1)
-	go StartMonitor(cfg, cm)
+	go StartMonitor(cfg, agent, cm)
 
-	instruments.InstrumentWithConfig(cfg)
+	instruments.InstrumentWithConfig(
+		cfg,
+		instruments.WithBatching(instruments.DefaultBatchSize, instruments.DefaultFlushInterval),
+	)
 
 	r := gin.Default()
 	r.GET("/ping", func(c *gin.Context) {
@@ -114,6 +125,7 @@ func main() {
 
 	log.Println("closing monitors and collectors")
 
+	instruments.Close()
 	cc <- struct{}{}
 	cm <- struct{}{}
 	srv.Shutdown(ctx)
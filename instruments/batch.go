@@ -0,0 +1,218 @@
+package instruments
+
+import (
+	"context"
+	"fmt"
+	"hawkeye/collector/raider"
+	"hawkeye/protocols"
+	"hawkeye/utils"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 200 * time.Millisecond
+)
+
+// batcher buffers metrics in a channel, and sends them with one Metric.HandleBatch
+// call when the batch size is reached or at every flush interval.
+// Counters of the same metric and tags are summed before they are sent.
+type batcher struct {
+	client   utils.RPCClient
+	size     int
+	interval time.Duration
+
+	mu      sync.RWMutex
+	closed  bool
+	lines   chan string
+	flushes chan chan struct{}
+	done    chan struct{}
+}
+
+func newBatcher(client utils.RPCClient, size int, interval time.Duration) *batcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	b := &batcher{
+		client:   client,
+		size:     size,
+		interval: interval,
+		lines:    make(chan string, size*10),
+		flushes:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go b.run()
+	return b
+}
+
+// add enqueues the metric, it never blocks. When the buffer
+// is full, the metric is dropped.
+func (b *batcher) add(line string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	select {
+	case b.lines <- line:
+	default:
+		log.Println("metric dropped ", line)
+	}
+}
+
+// flush sends the buffered metrics and waits for it.
+func (b *batcher) flush() {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+
+	done := make(chan struct{})
+	b.flushes <- done
+	b.mu.RUnlock()
+
+	<-done
+}
+
+// close sends the buffered metrics and stops the batcher.
+func (b *batcher) close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+
+	b.closed = true
+	close(b.lines)
+	b.mu.Unlock()
+
+	<-b.done
+}
+
+func (b *batcher) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	defer close(b.done)
+
+	pending := newPendingBatch()
+
+	for {
+		select {
+		case line, ok := <-b.lines:
+			if !ok {
+				b.send(pending.texts())
+				return
+			}
+
+			pending.add(line)
+			if pending.len() >= b.size {
+				b.send(pending.texts())
+				pending = newPendingBatch()
+			}
+
+		case <-ticker.C:
+			if pending.len() > 0 {
+				b.send(pending.texts())
+				pending = newPendingBatch()
+			}
+
+		case done := <-b.flushes:
+			if pending.len() > 0 {
+				b.send(pending.texts())
+				pending = newPendingBatch()
+			}
+			close(done)
+		}
+	}
+}
+
+func (b *batcher) send(texts []string) {
+	if len(texts) == 0 {
+		return
+	}
+
+	var reply int
+	b.client.Go("Metric.HandleBatch", raider.MetricBatch{Texts: texts}, &reply, nil)
+}
+
+type pendingBatch struct {
+	counters map[string]float64
+	order    []string
+	lines    []string
+}
+
+func newPendingBatch() *pendingBatch {
+	return &pendingBatch{counters: map[string]float64{}}
+}
+
+func (p *pendingBatch) len() int {
+	return len(p.counters) + len(p.lines)
+}
+
+// add sums up plain counters by metric and tags. Everything else,
+// including counters sent with a timestamp, is sent as is.
+func (p *pendingBatch) add(line string) {
+	m, err := protocols.ParseDatagram(context.Background(), line)
+	if err != nil || m.Type != protocols.MetricTypeCounter || m.Timestamp > 0 || m.ContainerID != "" {
+		p.lines = append(p.lines, line)
+		return
+	}
+
+	key := m.Name
+	if len(m.TagList) > 0 {
+		key += "|#" + datagramTags(m.TagList)
+	}
+
+	if _, ok := p.counters[key]; !ok {
+		p.order = append(p.order, key)
+	}
+
+	p.counters[key] += float64(m.SampledValue())
+}
+
+// datagramTags are the tags of a datagram sorted by key, for the same tags to sum up
+// whatever their order. Unlike the series keys, the datagram tags are not escaped.
+func datagramTags(tags protocols.MetricTag) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+":"+tags[key])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (p *pendingBatch) texts() []string {
+	texts := make([]string, 0, p.len())
+
+	for _, key := range p.order {
+		name, tags, _ := strings.Cut(key, "|")
+
+		text := fmt.Sprintf("%s:%g|c", name, p.counters[key])
+		if tags != "" {
+			text += "|" + tags
+		}
+
+		texts = append(texts, text)
+	}
+
+	return append(texts, p.lines...)
+}
@@ -0,0 +1,156 @@
+package instruments
+
+import (
+	"hawkeye/collector/raider"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient records the batches sent, and tells when one is sent.
+type fakeClient struct {
+	mu      sync.Mutex
+	methods []string
+	batches [][]string
+	sent    chan struct{}
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{sent: make(chan struct{}, 100)}
+}
+
+func (f *fakeClient) Call(string, any, any) error {
+	return nil
+}
+
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func (f *fakeClient) Go(serviceMethod string, args any, _ any, _ chan *rpc.Call) *rpc.Call {
+	f.mu.Lock()
+	f.methods = append(f.methods, serviceMethod)
+	if batch, ok := args.(raider.MetricBatch); ok {
+		f.batches = append(f.batches, batch.Texts)
+	}
+	f.mu.Unlock()
+
+	f.sent <- struct{}{}
+	return nil
+}
+
+func (f *fakeClient) wait(t *testing.T, timeout time.Duration) {
+	t.Helper()
+
+	select {
+	case <-f.sent:
+	case <-time.After(timeout):
+		t.Fatalf("expected a batch to be sent within %s", timeout)
+	}
+}
+
+func (f *fakeClient) sentBatches() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.batches
+}
+
+func TestBatchFlushesOnSize(t *testing.T) {
+	client := newFakeClient()
+	i := NewInstrument(client, WithBatching(3, time.Hour))
+	defer i.Close()
+
+	i.SendMetric("cpu:0.5|g")
+	i.SendMetric("memory:512|g")
+
+	select {
+	case <-client.sent:
+		t.Fatalf("expected no batch before the size, got %v", client.sentBatches())
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	i.SendMetric("disk:0.9|g")
+	client.wait(t, time.Second)
+
+	expected := [][]string{{"cpu:0.5|g", "memory:512|g", "disk:0.9|g"}}
+	if batches := client.sentBatches(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected %v, got %v", expected, batches)
+	}
+
+	if client.methods[0] != "Metric.HandleBatch" {
+		t.Errorf("expected the batch to be sent with Metric.HandleBatch, got %s", client.methods[0])
+	}
+}
+
+func TestBatchFlushesOnInterval(t *testing.T) {
+	client := newFakeClient()
+	i := NewInstrument(client, WithBatching(100, 20*time.Millisecond))
+	defer i.Close()
+
+	start := time.Now()
+	i.SendMetric("cpu:0.5|g")
+	client.wait(t, time.Second)
+
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("expected the batch to be sent at the interval, after %s", waited)
+	}
+
+	expected := [][]string{{"cpu:0.5|g"}}
+	if batches := client.sentBatches(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected %v, got %v", expected, batches)
+	}
+}
+
+func TestBatchSumsCounters(t *testing.T) {
+	client := newFakeClient()
+	i := NewInstrument(client, WithBatching(100, time.Hour))
+
+	for _, line := range []string{
+		"http.request:1|c|#route:/pay,method:GET",
+		"cpu:3|g",
+		"http.request:0.5|c",
+		"http.request:2|c|#method:GET,route:/pay",
+		// sampled counters are summed scaled back up
+		"http.request:1|c|@0.5",
+		// counters with a timestamp are sent as is
+		"http.request:1|c|T1700000000",
+		"http.request:-1|c|#route:/pay,method:GET",
+	} {
+		i.SendMetric(line)
+	}
+
+	i.Close()
+
+	expected := [][]string{{
+		"http.request:2|c|#method:GET,route:/pay",
+		"http.request:2.5|c",
+		"cpu:3|g",
+		"http.request:1|c|T1700000000",
+	}}
+
+	if batches := client.sentBatches(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected %v, got %v", expected, batches)
+	}
+}
+
+func TestBatchFlush(t *testing.T) {
+	client := newFakeClient()
+	i := NewInstrument(client, WithBatching(100, time.Hour))
+	defer i.Close()
+
+	i.Flush()
+	if batches := client.sentBatches(); len(batches) != 0 {
+		t.Errorf("expected nothing to be sent without metrics, got %v", batches)
+	}
+
+	i.SendMetric("cpu:0.5|g")
+	i.Flush()
+
+	expected := [][]string{{"cpu:0.5|g"}}
+	if batches := client.sentBatches(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected %v, got %v", expected, batches)
+	}
+}
@@ -7,11 +7,28 @@ import (
 	"hawkeye/config"
 	"hawkeye/utils"
 	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 type Instrument struct {
 	client utils.RPCClient
+	batch  *batcher
+
+	batchSize     int
+	flushInterval time.Duration
+}
+
+type InstrumentOpts func(i *Instrument)
+
+// WithBatching buffers the metrics, and sends them in batches of size, or at
+// every interval, whichever comes first. Counters are summed before sending.
+func WithBatching(size int, interval time.Duration) InstrumentOpts {
+	return func(i *Instrument) {
+		i.batchSize = size
+		i.flushInterval = interval
+	}
 }
 
 var (
@@ -19,20 +36,55 @@ var (
 	inst *Instrument
 )
 
-func InstrumentWithConfig(cfg config.AppConfig) {
+func InstrumentWithConfig(cfg config.AppConfig, opts ...InstrumentOpts) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	inst = &Instrument{
-		client: utils.InitClientUnix(),
+	if inst != nil {
+		inst.Close()
 	}
+
+	inst = NewInstrument(utils.InitClientUnix(), opts...)
+}
+
+func NewInstrument(client utils.RPCClient, opts ...InstrumentOpts) *Instrument {
+	i := &Instrument{client: client}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	if i.batchSize > 0 || i.flushInterval > 0 {
+		i.batch = newBatcher(client, i.batchSize, i.flushInterval)
+	}
+
+	return i
 }
 
 func (i *Instrument) SendMetric(metric string) {
+	if i.batch != nil {
+		i.batch.add(metric)
+		return
+	}
+
 	var reply int
 	i.client.Go("Metric.Handle", raider.Metric{Text: metric}, &reply, nil)
 }
 
+// Flush sends the buffered metrics, if batching is enabled.
+func (i *Instrument) Flush() {
+	if i.batch != nil {
+		i.batch.flush()
+	}
+}
+
+// Close sends the buffered metrics, and stops batching.
+func (i *Instrument) Close() {
+	if i.batch != nil {
+		i.batch.close()
+	}
+}
+
 func (i *Instrument) Count(ctx context.Context, metric string, dir int) {
 	value := 1 * dir
 	mKey := fmt.Sprintf("%s:%d|c", metric, value)
@@ -42,6 +94,29 @@ func (i *Instrument) Count(ctx context.Context, metric string, dir int) {
 	i.SendMetric(mKey)
 }
 
+// CountSampled sends the count only for a fraction of the calls, given by the rate.
+// The rate is sent along, so that the collector scales the count back up.
+func (i *Instrument) CountSampled(ctx context.Context, metric string, dir int, rate float64) {
+	if rate <= 0 || rate > 1 {
+		log.Println("invalid sample rate ", rate, " for ", metric)
+		return
+	}
+
+	if rate == 1 {
+		i.Count(ctx, metric, dir)
+		return
+	}
+
+	if rand.Float64() >= rate {
+		return
+	}
+
+	value := 1 * dir
+	mKey := fmt.Sprintf("%s:%d|c|@%g", metric, value, rate)
+
+	i.SendMetric(mKey)
+}
+
 func (i *Instrument) Incr(ctx context.Context, metric string) {
 	i.Count(ctx, metric, 1)
 
@@ -51,6 +126,14 @@ func (i *Instrument) Decr(ctx context.Context, metric string) {
 	i.Count(ctx, metric, -1)
 }
 
+func (i *Instrument) IncrSampled(ctx context.Context, metric string, rate float64) {
+	i.CountSampled(ctx, metric, 1, rate)
+}
+
+func (i *Instrument) DecrSampled(ctx context.Context, metric string, rate float64) {
+	i.CountSampled(ctx, metric, -1, rate)
+}
+
 func Incr(ctx context.Context, metric string) {
 	mu.RLock()
 	defer mu.RUnlock()
@@ -72,3 +155,39 @@ func Decr(ctx context.Context, metric string) {
 
 	inst.Decr(ctx, metric)
 }
+
+func IncrSampled(ctx context.Context, metric string, rate float64) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if inst == nil {
+		return
+	}
+
+	inst.IncrSampled(ctx, metric, rate)
+}
+
+func DecrSampled(ctx context.Context, metric string, rate float64) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if inst == nil {
+		return
+	}
+
+	inst.DecrSampled(ctx, metric, rate)
+}
+
+// Close sends the buffered metrics of the default instrument, and
+// stops it. It should be called before the application exits.
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if inst == nil {
+		return
+	}
+
+	inst.Close()
+	inst = nil
+}
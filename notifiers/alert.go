@@ -0,0 +1,90 @@
+package notifiers
+
+import (
+	"hawkeye/utils"
+	"time"
+)
+
+// The keys of the values the monitors send to the notifiers. The values are
+// also available to the trigger text templates, as {{ .value }} and so on.
+const (
+	ValueMetric    = "metric"
+	ValueValue     = "value"
+	ValueThreshold = "threshold"
+	ValueEnv       = "env"
+	ValueTags      = "tags"
+	ValueSeverity  = "severity"
+	// ValueCount is the description of the breach, kept as count for the existing templates.
+	ValueCount = "count"
+	// ValueState and ValuePreviousState are the transition the values are sent for.
+	ValueState         = "state"
+	ValuePreviousState = "previous_state"
+	// ValuePeak is the highest value since the alert started, and ValueDuration how long it lasted.
+	ValuePeak     = "peak"
+	ValueDuration = "duration"
+)
+
+// State is the state of the alert of a monitor trigger, for a group of series.
+type State string
+
+const (
+	// StateOK is under the threshold.
+	StateOK State = "OK"
+	// StatePending is over the threshold, but not for long enough to alert.
+	StatePending State = "PENDING"
+	// StateAlerting is over the threshold, and notified.
+	StateAlerting State = "ALERTING"
+	// StateNoData is when the series of the group are not found anymore.
+	StateNoData State = "NO_DATA"
+	// StateResolved is back under the threshold after alerting, until the next check.
+	StateResolved State = "RESOLVED"
+)
+
+type alert struct {
+	Metric      string
+	Value       float32
+	Threshold   float32
+	Env         string
+	Tags        string
+	Severity    string
+	Description string
+	At          time.Time
+	State       State
+	Previous    State
+	Peak        float32
+	Duration    string
+}
+
+// Alerting is true when the values are sent for a breach, which is also
+// the case for monitors which do not send the state.
+func (a alert) Alerting() bool {
+	return a.State == "" || a.State == StateAlerting
+}
+
+func alertOf(values map[string]interface{}, cfg NotifierConfig) alert {
+	a := alert{
+		Env: cfg.Environment,
+		At:  utils.Now(),
+	}
+
+	a.Metric, _ = values[ValueMetric].(string)
+	a.Value, _ = values[ValueValue].(float32)
+	a.Threshold, _ = values[ValueThreshold].(float32)
+	a.Tags, _ = values[ValueTags].(string)
+	a.Severity, _ = values[ValueSeverity].(string)
+	a.Description, _ = values[ValueCount].(string)
+	a.State, _ = values[ValueState].(State)
+	a.Previous, _ = values[ValuePreviousState].(State)
+	a.Peak, _ = values[ValuePeak].(float32)
+	a.Duration, _ = values[ValueDuration].(string)
+
+	if a.Severity == "" {
+		a.Severity = cfg.Severity
+	}
+
+	if env, ok := values[ValueEnv].(string); ok && env != "" {
+		a.Env = env
+	}
+
+	return a
+}
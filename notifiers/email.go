@@ -3,22 +3,36 @@ package notifiers
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"hawkeye/collector/aggregator"
-	"hawkeye/utils"
+	htmltemplate "html/template"
 	"log"
 	"text/template"
-	"time"
 )
 
 type Notifier interface {
 	Send(context.Context, map[string]interface{}) error
 }
 
+// Resolver is implemented by the notifiers which can close the alert they sent,
+// once the value is back under the threshold.
+type Resolver interface {
+	Resolve(context.Context, map[string]interface{}) error
+}
+
 type NotifierConfig struct {
-	lastNotifyAt time.Time
-	interval     time.Duration
-	ServiceName  string
-	Environment  string
+	ServiceName string
+	Environment string
+	// Monitor is the metric of the monitor, shown in the notifications, and MonitorID
+	// is unique among the monitors, to key the incidents and throttles of the monitor.
+	Monitor   string
+	MonitorID string
+	// Trigger and Channel are the positions of the channel in the triggers and channels.
+	Trigger int
+	Channel int
+	// Severity is the level of the trigger, like warn or critical, and Threshold the value it alerts at.
+	Severity  string
+	Threshold float32
 }
 
 type EmailNotifier struct {
@@ -27,7 +41,9 @@ type EmailNotifier struct {
 	mailerCfg MailerConfig
 }
 
-func NewEmailNotifier(mailer MailingService, trigger aggregator.Trigger, cfg NotifierConfig) EmailNotifier {
+// NewEmailNotifier sends every notification as an email. To not send the same
+// alert again too soon, wrap it with a ThrottledNotifier.
+func NewEmailNotifier(mailer MailingService, channel aggregator.Channel, cfg NotifierConfig) *EmailNotifier {
 	var buf = bytes.Buffer{}
 
 	buf.WriteString(cfg.ServiceName)
@@ -37,44 +53,79 @@ func NewEmailNotifier(mailer MailingService, trigger aggregator.Trigger, cfg Not
 	buf.WriteString(cfg.Environment)
 	buf.WriteString("\n")
 
-	if trigger.Text != nil {
-		buf.WriteString(*trigger.Text)
+	if channel.Text != nil {
+		buf.WriteString(*channel.Text)
 		buf.WriteString("\n")
 	}
 
-	interval := -1 * time.Duration(trigger.RunEveryMinute) * time.Minute
+	html := ""
+	if channel.HTML != nil {
+		html = *channel.HTML
+	}
 
-	return EmailNotifier{
+	return &EmailNotifier{
 		mailer: mailer,
 		mailerCfg: MailerConfig{
-			Subject:    trigger.Subject,
+			Subject:    channel.Subject,
 			Body:       buf.String(),
-			Recipients: trigger.To,
-		},
-		config: NotifierConfig{
-			lastNotifyAt: utils.Now().Add(-interval),
-			interval:     interval,
+			HTMLBody:   html,
+			Recipients: channel.To,
+			CC:         channel.CC,
+			Bcc:        channel.Bcc,
 		},
+		config: cfg,
 	}
 }
 
-func (n EmailNotifier) Send(ctx context.Context, values map[string]interface{}) error {
-	now := utils.Now()
-	if now.Sub(n.config.lastNotifyAt) < n.config.interval {
-		return nil
-	}
+func (n *EmailNotifier) Send(ctx context.Context, values map[string]interface{}) error {
+	// the email is rendered on a copy, the body stays the template for the next one
+	mailerCfg := n.mailerCfg
+
+	if alert := alertOf(values, n.config); !alert.Alerting() {
+		mailerCfg.Subject = fmt.Sprintf("[%s] %s", alert.State, mailerCfg.Subject)
+		mailerCfg.Body = n.config.ServiceName + "\n" + alert.Description + "\n"
+		mailerCfg.HTMLBody = ""
 
-	n.config.lastNotifyAt = now
+		log.Println("SLA", alert.State, "Notifying")
+		return n.mailer.Send(ctx, mailerCfg)
+	}
 
 	log.Println("SLA Breached. Notifying")
-	// log.Println("sending emails ", body, n.subject)
 
-	n.mailerCfg.Body = RenderTextTemplate(n.mailerCfg.Body, values)
-	return n.mailer.Send(ctx, n.mailerCfg)
+	mailerCfg.Body = RenderTextTemplate(n.mailerCfg.Body, values)
+	if mailerCfg.HTMLBody != "" {
+		mailerCfg.HTMLBody = RenderHTMLTemplate(mailerCfg.HTMLBody, values)
+	}
+	return n.mailer.Send(ctx, mailerCfg)
 }
 
+// RenderHTMLTemplate renders the html with the values, escaping them. The html is returned
+// as it is if it is not a valid template.
+func RenderHTMLTemplate(text string, values map[string]interface{}) string {
+	templ, err := htmltemplate.New("custom html template").Parse(text)
+	if err != nil {
+		log.Println("failed to parse html template ", err)
+		return text
+	}
+
+	var by bytes.Buffer
+
+	if err := templ.Execute(&by, values); err != nil {
+		log.Println("failed to render html template ", err)
+		return text
+	}
+
+	return by.String()
+}
+
+// RenderTextTemplate renders the text with the values, the text is returned as it is if it is not a valid template.
 func RenderTextTemplate(text string, values map[string]interface{}) string {
-	templ := template.Must(template.New("custom template").Parse(text))
+	templ, err := template.New("custom template").Parse(text)
+	if err != nil {
+		log.Println("failed to parse template ", err)
+		return text
+	}
+
 	var by bytes.Buffer
 
 	if err := templ.Execute(&by, values); err != nil {
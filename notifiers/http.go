@@ -0,0 +1,82 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// postJSON posts the json body to the url. Requests failing with a 5xx, a 429 or
+// a network error are retried, the wait before each retry doubles from backoff.
+// The error is a *NotificationError, unless the request could not be built.
+func postJSON(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	header http.Header,
+	body []byte,
+	retries int,
+	backoff time.Duration,
+) error {
+	var nerr *NotificationError
+	wait := backoff
+
+	for attempt := 1; attempt <= retries+1; attempt++ {
+		nerr = post(ctx, client, url, header, body)
+		if nerr == nil {
+			return nil
+		}
+
+		nerr.Attempts = attempt
+		if !nerr.Temporary() || attempt > retries {
+			break
+		}
+
+		log.Println("notification failed, retrying in ", wait, nerr)
+
+		select {
+		case <-ctx.Done():
+			nerr.Err = ctx.Err()
+			return nerr
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+
+	return nerr
+}
+
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) *NotificationError {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &NotificationError{Err: err}
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return &NotificationError{Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+
+	resBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+
+	return &NotificationError{
+		StatusCode: res.StatusCode,
+		Body:       strings.TrimSpace(string(resBody)),
+	}
+}
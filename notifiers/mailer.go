@@ -6,12 +6,13 @@ import (
 )
 
 type MailerConfig struct {
-	Subject    string
-	Body       string
-	Recipients []string
-	Sender     string
-	CC         []string
-	Bcc        []string
+	Subject    string   `json:"subject"`
+	Body       string   `json:"body"`
+	HTMLBody   string   `json:"html_body,omitempty"`
+	Recipients []string `json:"recipients"`
+	Sender     string   `json:"sender,omitempty"`
+	CC         []string `json:"cc,omitempty"`
+	Bcc        []string `json:"bcc,omitempty"`
 }
 
 type MailingService interface {
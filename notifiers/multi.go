@@ -0,0 +1,44 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MultiNotifier sends every notification to all of its notifiers, the channels of a trigger.
+// A failing notifier does not keep the others from being notified.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Send(ctx context.Context, values map[string]interface{}) error {
+	return m.each(func(n Notifier) error {
+		return n.Send(ctx, values)
+	})
+}
+
+// Resolve resolves with the notifiers which can resolve, the others are sent the resolved values.
+func (m MultiNotifier) Resolve(ctx context.Context, values map[string]interface{}) error {
+	return m.each(func(n Notifier) error {
+		if resolver, ok := n.(Resolver); ok {
+			return resolver.Resolve(ctx, values)
+		}
+
+		return n.Send(ctx, values)
+	})
+}
+
+func (m MultiNotifier) each(notify func(n Notifier) error) error {
+	var failed []string
+
+	for _, n := range m {
+		if err := notify(n); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %d of %d channels: %s", ErrNotificationFailed, len(failed), len(m), strings.Join(failed, "; "))
+	}
+
+	return nil
+}
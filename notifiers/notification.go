@@ -0,0 +1,132 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NotificationService sends the emails through the notification service api.
+// The MailerConfig is posted as json, with the token as bearer auth.
+// Requests failing with a 5xx or a network error are retried with backoff.
+type NotificationService struct {
+	url     string
+	token   string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+const (
+	DefaultNotificationPath    = "/v1/email"
+	DefaultNotificationTimeout = 10 * time.Second
+	DefaultNotificationRetries = 3
+	DefaultNotificationBackoff = 500 * time.Millisecond
+)
+
+type NotificationServiceOpts func(n *NotificationService)
+
+func WithHTTPClient(client *http.Client) NotificationServiceOpts {
+	return func(n *NotificationService) {
+		n.client = client
+	}
+}
+
+// WithRetries sets how many times a failed request is retried. The wait
+// before each retry doubles, starting from backoff.
+func WithRetries(retries int, backoff time.Duration) NotificationServiceOpts {
+	return func(n *NotificationService) {
+		n.retries = retries
+		n.backoff = backoff
+	}
+}
+
+// NewNotificationService posts to DefaultNotificationPath of the base url.
+// A base url which already has a path is used as is.
+func NewNotificationService(baseURL, token string, opts ...NotificationServiceOpts) *NotificationService {
+	url := strings.TrimSuffix(baseURL, "/")
+	if !hasPath(url) {
+		url += DefaultNotificationPath
+	}
+
+	n := &NotificationService{
+		url:     url,
+		token:   token,
+		client:  &http.Client{Timeout: DefaultNotificationTimeout},
+		retries: DefaultNotificationRetries,
+		backoff: DefaultNotificationBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
+}
+
+func hasPath(url string) bool {
+	rest := url
+	if _, after, found := strings.Cut(url, "://"); found {
+		rest = after
+	}
+
+	return strings.Contains(rest, "/")
+}
+
+var ErrNotificationFailed = errors.New("notification_failed")
+
+// NotificationError is returned when the notification service could not be reached,
+// or responded with an error status. StatusCode is 0 when there was no response.
+type NotificationError struct {
+	StatusCode int
+	Body       string
+	Attempts   int
+	Err        error
+}
+
+func (e *NotificationError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s after %d attempts: %v", ErrNotificationFailed, e.Attempts, e.Err)
+	}
+
+	return fmt.Sprintf("%s after %d attempts: status %d: %s", ErrNotificationFailed, e.Attempts, e.StatusCode, e.Body)
+}
+
+// Unwrap is the transport error, errors.Is matches ErrNotificationFailed for
+// every NotificationError with Is.
+func (e *NotificationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NotificationError) Is(target error) bool {
+	return target == ErrNotificationFailed
+}
+
+// Temporary reports whether the request failed for a reason that could go away on a retry.
+func (e *NotificationError) Temporary() bool {
+	return e.StatusCode == 0 || e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+func (n *NotificationService) Send(ctx context.Context, cfg MailerConfig) error {
+	body, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	if err := postJSON(ctx, n.client, n.url, header, body, n.retries, n.backoff); err != nil {
+		return err
+	}
+
+	log.Println("emails sent to ", len(cfg.Recipients), " recipients")
+	return nil
+}
@@ -0,0 +1,178 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a notification service stand-in, answering with the statuses in order.
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	delay    time.Duration
+	requests []*http.Request
+	bodies   []MailerConfig
+	at       []time.Time
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	var cfg MailerConfig
+	json.NewDecoder(req.Body).Decode(&cfg)
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, cfg)
+	r.at = append(r.at, time.Now())
+
+	status := http.StatusOK
+	if n := len(r.requests); n <= len(r.statuses) {
+		status = r.statuses[n-1]
+	}
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+	w.WriteHeader(status)
+	w.Write([]byte("status body"))
+}
+
+func (r *recorder) calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.requests)
+}
+
+var testMail = MailerConfig{Subject: "cpu high", Body: "cpu is 95%", Recipients: []string{"oncall@example.com"}}
+
+func TestNotificationServiceBearerAuth(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	n := NewNotificationService(server.URL, "secret")
+	if err := n.Send(context.Background(), testMail); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if rec.calls() != 1 {
+		t.Fatalf("expected 1 request, got %d", rec.calls())
+	}
+
+	req := rec.requests[0]
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("expected bearer auth, got %q", got)
+	}
+
+	if req.URL.Path != DefaultNotificationPath {
+		t.Errorf("expected path %s, got %s", DefaultNotificationPath, req.URL.Path)
+	}
+
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected json content type, got %q", got)
+	}
+
+	if rec.bodies[0].Subject != testMail.Subject || rec.bodies[0].Recipients[0] != testMail.Recipients[0] {
+		t.Errorf("unexpected body %+v", rec.bodies[0])
+	}
+}
+
+func TestNotificationServiceRetries5xxWithBackoff(t *testing.T) {
+	rec := &recorder{statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	backoff := 20 * time.Millisecond
+	n := NewNotificationService(server.URL, "", WithRetries(3, backoff))
+
+	if err := n.Send(context.Background(), testMail); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+
+	if rec.calls() != 3 {
+		t.Fatalf("expected 3 requests, got %d", rec.calls())
+	}
+
+	if wait := rec.at[1].Sub(rec.at[0]); wait < backoff {
+		t.Errorf("expected the first retry after %s, got %s", backoff, wait)
+	}
+
+	if wait := rec.at[2].Sub(rec.at[1]); wait < 2*backoff {
+		t.Errorf("expected the backoff to double to %s, got %s", 2*backoff, wait)
+	}
+}
+
+func TestNotificationServiceGivesUpAfterRetries(t *testing.T) {
+	rec := &recorder{statuses: []int{500, 500, 500}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	n := NewNotificationService(server.URL, "", WithRetries(2, time.Millisecond))
+
+	err := n.Send(context.Background(), testMail)
+
+	var nerr *NotificationError
+	if !errors.As(err, &nerr) {
+		t.Fatalf("expected a NotificationError, got %v", err)
+	}
+
+	if nerr.StatusCode != 500 || nerr.Attempts != 3 || nerr.Body != "status body" {
+		t.Errorf("unexpected error %+v", nerr)
+	}
+
+	if !errors.Is(err, ErrNotificationFailed) {
+		t.Errorf("expected %v to be ErrNotificationFailed", err)
+	}
+}
+
+func TestNotificationService4xxIsNotRetried(t *testing.T) {
+	rec := &recorder{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	n := NewNotificationService(server.URL, "", WithRetries(3, time.Millisecond))
+
+	err := n.Send(context.Background(), testMail)
+	if !errors.Is(err, ErrNotificationFailed) {
+		t.Fatalf("expected ErrNotificationFailed, got %v", err)
+	}
+
+	if rec.calls() != 1 {
+		t.Errorf("expected a 4xx not to be retried, got %d requests", rec.calls())
+	}
+}
+
+func TestNotificationServiceTimeout(t *testing.T) {
+	rec := &recorder{delay: 200 * time.Millisecond}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 20 * time.Millisecond}
+	n := NewNotificationService(server.URL, "", WithHTTPClient(client), WithRetries(1, time.Millisecond))
+
+	err := n.Send(context.Background(), testMail)
+
+	var nerr *NotificationError
+	if !errors.As(err, &nerr) {
+		t.Fatalf("expected a NotificationError, got %v", err)
+	}
+
+	if nerr.StatusCode != 0 || nerr.Attempts != 2 {
+		t.Errorf("expected 2 attempts without a response, got %+v", nerr)
+	}
+
+	// a transport error is both the notification failure and the cause
+	if !errors.Is(err, ErrNotificationFailed) {
+		t.Errorf("expected %v to be ErrNotificationFailed", err)
+	}
+
+	var timeout interface{ Timeout() bool }
+	if !errors.As(err, &timeout) || !timeout.Timeout() {
+		t.Errorf("expected %v to be a timeout", err)
+	}
+}
@@ -0,0 +1,203 @@
+package notifiers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hawkeye/collector/aggregator"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPagerDutyEndpoint = "https://events.pagerduty.com/v2/enqueue"
+	DefaultPagerDutySeverity = "critical"
+
+	PagerDutyTrigger = "trigger"
+	PagerDutyResolve = "resolve"
+)
+
+// PagerDutyNotifier pages with the PagerDuty Events API v2. The incident is
+// triggered when the threshold is breached, and resolved when the value is back under it.
+// Both use the same dedup_key, so repeated breaches are grouped in the same incident.
+type PagerDutyNotifier struct {
+	config     NotifierConfig
+	endpoint   string
+	routingKey string
+	severity   string
+	subject    string
+	text       string
+	client     *http.Client
+}
+
+var (
+	ErrMissingRoutingKey = errors.New("missing_pagerduty_routing_key")
+	ErrInvalidSeverity   = errors.New("invalid_pagerduty_severity")
+)
+
+// pagerDutySeverities are the PagerDuty severities of the trigger severities,
+// used when the pagerduty config does not set one.
+var pagerDutySeverities = map[string]string{
+	aggregator.SeverityInfo:     "info",
+	aggregator.SeverityWarn:     "warning",
+	aggregator.SeverityCritical: "critical",
+}
+
+// NewPagerDutyNotifier builds the notifier from the pagerduty config of the channel.
+// Environment variables in the routing key and endpoint are expanded.
+func NewPagerDutyNotifier(channel aggregator.Channel, cfg NotifierConfig) (Notifier, error) {
+	if channel.PagerDuty == nil || channel.PagerDuty.RoutingKey == "" {
+		return nil, ErrMissingRoutingKey
+	}
+
+	pd := channel.PagerDuty
+
+	endpoint := os.ExpandEnv(pd.Endpoint)
+	if endpoint == "" {
+		endpoint = DefaultPagerDutyEndpoint
+	}
+
+	severity := pd.Severity
+	if severity == "" {
+		severity = pagerDutySeverities[cfg.Severity]
+	}
+
+	if severity == "" {
+		severity = DefaultPagerDutySeverity
+	}
+
+	switch severity {
+	case "critical", "error", "warning", "info":
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSeverity, severity)
+	}
+
+	text := ""
+	if channel.Text != nil {
+		text = *channel.Text
+	}
+
+	return &PagerDutyNotifier{
+		config:     cfg,
+		endpoint:   endpoint,
+		routingKey: os.ExpandEnv(pd.RoutingKey),
+		severity:   severity,
+		subject:    channel.Subject,
+		text:       text,
+		client:     &http.Client{Timeout: DefaultNotificationTimeout},
+	}, nil
+}
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+func (n *PagerDutyNotifier) Send(ctx context.Context, values map[string]interface{}) error {
+	alert := alertOf(values, n.config)
+
+	summary := alert.Description
+	if alert.Alerting() && n.text != "" {
+		summary = RenderTextTemplate(n.text, values)
+	} else if n.subject != "" {
+		summary = n.subject + ": " + alert.Description
+	}
+
+	details := map[string]interface{}{
+		"value":     alert.Value,
+		"threshold": alert.Threshold,
+		"env":       alert.Env,
+	}
+
+	if alert.Tags != "" {
+		details["tags"] = alert.Tags
+	}
+
+	if alert.State != "" {
+		details["state"] = alert.State
+	}
+
+	source := n.config.ServiceName
+	if source == "" {
+		source = "hawkeye"
+	}
+
+	return n.send(ctx, pagerDutyEvent{
+		RoutingKey:  n.routingKey,
+		EventAction: PagerDutyTrigger,
+		DedupKey:    n.DedupKey(alert.Tags),
+		Payload: &pagerDutyPayload{
+			Summary:       truncate(summary, 1024),
+			Source:        source,
+			Severity:      n.severity,
+			Timestamp:     alert.At.Format(time.RFC3339),
+			Component:     alert.Metric,
+			Group:         alert.Env,
+			CustomDetails: details,
+		},
+	})
+}
+
+// Resolve resolves the incident triggered for the same tags.
+func (n *PagerDutyNotifier) Resolve(ctx context.Context, values map[string]interface{}) error {
+	alert := alertOf(values, n.config)
+
+	return n.send(ctx, pagerDutyEvent{
+		RoutingKey:  n.routingKey,
+		EventAction: PagerDutyResolve,
+		DedupKey:    n.DedupKey(alert.Tags),
+	})
+}
+
+// DedupKey is stable for the monitor, trigger and environment, so the incident
+// can be resolved even after a restart or a reload. The monitor is its ID, and the
+// trigger its severity and threshold, which do not change when the triggers are
+// reordered. The tags of the group are part of it, so every group of a monitor
+// has its own incident.
+func (n *PagerDutyNotifier) DedupKey(tags string) string {
+	key := fmt.Sprintf("%s|%s|%g|%s|%s", n.config.MonitorID, n.config.Severity, n.config.Threshold, n.config.Environment, tags)
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:16])
+}
+
+func (n *PagerDutyNotifier) send(ctx context.Context, event pagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err := postJSON(ctx, n.client, n.endpoint, nil, body, DefaultNotificationRetries, DefaultNotificationBackoff); err != nil {
+		return err
+	}
+
+	log.Println("pagerduty", event.EventAction, "sent for", n.config.Monitor, event.DedupKey)
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	// cutting in the middle of a rune leaves invalid bytes at the end
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,131 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"hawkeye/collector/aggregator"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// pagerDutyStandIn keeps the events posted to it, in order.
+type pagerDutyStandIn struct {
+	mu     sync.Mutex
+	events []pagerDutyEvent
+}
+
+func (p *pagerDutyStandIn) server(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var event pagerDutyEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("invalid event %s: %v", body, err)
+		}
+
+		p.mu.Lock()
+		p.events = append(p.events, event)
+		p.mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newPagerDuty(t *testing.T, endpoint string, cfg NotifierConfig) *PagerDutyNotifier {
+	t.Helper()
+
+	channel := aggregator.Channel{PagerDuty: &aggregator.PagerDutyConfig{RoutingKey: "routing", Endpoint: endpoint}}
+
+	n, err := NewPagerDutyNotifier(channel, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	return n.(*PagerDutyNotifier)
+}
+
+func alertFor(tags string, state State) map[string]interface{} {
+	return map[string]interface{}{
+		ValueMetric:    "http.response.500",
+		ValueValue:     float32(37),
+		ValueThreshold: float32(10),
+		ValueTags:      tags,
+		ValueCount:     "http.response.500{" + tags + "} is 37",
+		ValueState:     state,
+	}
+}
+
+func TestPagerDutyResolvesTheTriggeredIncident(t *testing.T) {
+	standIn := &pagerDutyStandIn{}
+	endpoint := standIn.server(t).URL
+	cfg := NotifierConfig{Environment: "prod", Monitor: "http.response.500", MonitorID: "checkout_5xx", Severity: aggregator.SeverityCritical, Threshold: 10}
+
+	ctx := context.Background()
+
+	if err := newPagerDuty(t, endpoint, cfg).Send(ctx, alertFor("route:/pay", StateAlerting)); err != nil {
+		t.Fatalf("trigger failed: %v", err)
+	}
+
+	// resolved by another notifier, like after a restart, or a reload which moved the trigger
+	cfg.Trigger, cfg.Channel = 2, 1
+	if err := newPagerDuty(t, endpoint, cfg).Resolve(ctx, alertFor("route:/pay", StateResolved)); err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+
+	if len(standIn.events) != 2 {
+		t.Fatalf("expected a trigger and a resolve, got %+v", standIn.events)
+	}
+
+	trigger, resolve := standIn.events[0], standIn.events[1]
+
+	if trigger.EventAction != PagerDutyTrigger || resolve.EventAction != PagerDutyResolve {
+		t.Errorf("expected a trigger then a resolve, got %s and %s", trigger.EventAction, resolve.EventAction)
+	}
+
+	if trigger.DedupKey == "" || trigger.DedupKey != resolve.DedupKey {
+		t.Errorf("expected the resolve to have the dedup_key %q of the trigger, got %q", trigger.DedupKey, resolve.DedupKey)
+	}
+
+	if trigger.RoutingKey != "routing" || trigger.Payload.Severity != "critical" || trigger.Payload.Component != "http.response.500" {
+		t.Errorf("unexpected trigger %+v %+v", trigger, trigger.Payload)
+	}
+
+	if resolve.Payload != nil {
+		t.Errorf("expected the resolve without a payload, got %+v", resolve.Payload)
+	}
+}
+
+func TestPagerDutyDedupKeys(t *testing.T) {
+	base := NotifierConfig{Environment: "prod", Monitor: "http.latency", MonitorID: "p50", Severity: aggregator.SeverityWarn, Threshold: 200}
+	key := newPagerDuty(t, "", base).DedupKey("route:/pay")
+
+	if again := newPagerDuty(t, "", base).DedupKey("route:/pay"); again != key {
+		t.Errorf("expected the dedup_key to be stable, got %q and %q", key, again)
+	}
+
+	others := map[string]func(cfg *NotifierConfig) string{
+		"group":       func(cfg *NotifierConfig) string { return "route:/refund" },
+		"monitor":     func(cfg *NotifierConfig) string { cfg.MonitorID = "p99"; return "route:/pay" },
+		"severity":    func(cfg *NotifierConfig) string { cfg.Severity = aggregator.SeverityCritical; return "route:/pay" },
+		"threshold":   func(cfg *NotifierConfig) string { cfg.Threshold = 500; return "route:/pay" },
+		"environment": func(cfg *NotifierConfig) string { cfg.Environment = "staging"; return "route:/pay" },
+		"untagged":    func(cfg *NotifierConfig) string { return "" },
+	}
+
+	for name, change := range others {
+		cfg := base
+		tags := change(&cfg)
+
+		if other := newPagerDuty(t, "", cfg).DedupKey(tags); other == key {
+			t.Errorf("expected another %s to have another dedup_key, got %q", name, other)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package notifiers
+
+import (
+	"errors"
+	"fmt"
+	"hawkeye/collector/aggregator"
+	"sort"
+	"sync"
+)
+
+const (
+	NotifierEmail     = "email"
+	NotifierSlack     = "slack"
+	NotifierWebhook   = "webhook"
+	NotifierPagerDuty = "pagerduty"
+)
+
+// NotifierFactory builds the notifier for a channel of a monitor trigger.
+type NotifierFactory func(channel aggregator.Channel, cfg NotifierConfig) (Notifier, error)
+
+// Registry has the notifier factories keyed by the notifier name used in monitors.yaml.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]NotifierFactory
+}
+
+var ErrUnknownNotifier = errors.New("unknown_notifier")
+
+func NewRegistry() *Registry {
+	return &Registry{factories: map[string]NotifierFactory{}}
+}
+
+// DefaultRegistry has the email, slack, webhook and pagerduty notifiers. Emails are sent with the mailer.
+func DefaultRegistry(mailer MailingService) *Registry {
+	r := NewRegistry()
+
+	r.Register(NotifierEmail, func(channel aggregator.Channel, cfg NotifierConfig) (Notifier, error) {
+		return NewEmailNotifier(mailer, channel, cfg), nil
+	})
+	r.Register(NotifierSlack, NewSlackNotifier)
+	r.Register(NotifierWebhook, NewWebhookNotifier)
+	r.Register(NotifierPagerDuty, NewPagerDutyNotifier)
+
+	return r
+}
+
+// Register adds the factory for the notifier name, replacing the previous one, if any.
+func (r *Registry) Register(name string, factory NotifierFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.factories[name] = factory
+}
+
+// New builds the notifier of the channel. Channels without a notifier are notified by email.
+func (r *Registry) New(channel aggregator.Channel, cfg NotifierConfig) (Notifier, error) {
+	name := channel.Notifier
+	if name == "" {
+		name = NotifierEmail
+	}
+
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNotifier, name)
+	}
+
+	return factory(channel, cfg)
+}
+
+// Names are the registered notifier names, sorted, for monitors.yaml to be validated against.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
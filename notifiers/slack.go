@@ -0,0 +1,140 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hawkeye/collector/aggregator"
+	"log"
+	"net/http"
+	"os"
+)
+
+// SlackNotifier posts the alert to a slack incoming webhook, as a Block Kit message
+// with the metric, value, threshold and environment.
+type SlackNotifier struct {
+	config  NotifierConfig
+	slack   aggregator.SlackConfig
+	subject string
+	text    string
+	client  *http.Client
+}
+
+var ErrMissingSlackWebhook = errors.New("missing_slack_webhook_url")
+
+// slackHeaderMaxLength is the most characters slack takes in the text of a header block,
+// a longer one fails the whole message with invalid_blocks.
+const slackHeaderMaxLength = 150
+
+// NewSlackNotifier builds the notifier from the slack config of the channel.
+// Environment variables in the webhook url are expanded, to keep it out of the config file.
+func NewSlackNotifier(channel aggregator.Channel, cfg NotifierConfig) (Notifier, error) {
+	if channel.Slack == nil || channel.Slack.WebhookURL == "" {
+		return nil, ErrMissingSlackWebhook
+	}
+
+	slack := *channel.Slack
+	slack.WebhookURL = os.ExpandEnv(slack.WebhookURL)
+
+	text := ""
+	if channel.Text != nil {
+		text = *channel.Text
+	}
+
+	return &SlackNotifier{
+		config:  cfg,
+		slack:   slack,
+		subject: channel.Subject,
+		text:    text,
+		client:  &http.Client{Timeout: DefaultNotificationTimeout},
+	}, nil
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackMessage struct {
+	Text     string       `json:"text"`
+	Channel  string       `json:"channel,omitempty"`
+	Username string       `json:"username,omitempty"`
+	Blocks   []slackBlock `json:"blocks"`
+}
+
+func (n *SlackNotifier) Send(ctx context.Context, values map[string]interface{}) error {
+	body, err := json.Marshal(n.message(values))
+	if err != nil {
+		return err
+	}
+
+	if err := postJSON(ctx, n.client, n.slack.WebhookURL, nil, body, DefaultNotificationRetries, DefaultNotificationBackoff); err != nil {
+		return err
+	}
+
+	log.Println("slack notification sent for ", values["metric"])
+	return nil
+}
+
+func (n *SlackNotifier) message(values map[string]interface{}) slackMessage {
+	alert := alertOf(values, n.config)
+
+	title := n.subject
+	if title == "" {
+		title = fmt.Sprintf("%s alert in %s", alert.Metric, alert.Env)
+	}
+
+	text := alert.Description
+	if !alert.Alerting() {
+		title = fmt.Sprintf("[%s] %s", alert.State, title)
+	} else if n.text != "" {
+		text = RenderTextTemplate(n.text, values)
+	}
+
+	fields := []slackText{
+		{Type: "mrkdwn", Text: "*Metric*\n" + alert.Metric},
+		{Type: "mrkdwn", Text: fmt.Sprintf("*Value*\n%.3f", alert.Value)},
+		{Type: "mrkdwn", Text: fmt.Sprintf("*Threshold*\n%.3f", alert.Threshold)},
+		{Type: "mrkdwn", Text: "*Env*\n" + alert.Env},
+	}
+
+	if alert.Tags != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Tags*\n" + alert.Tags})
+	}
+
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: truncateRunes(title, slackHeaderMaxLength)}},
+	}
+
+	if text != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}})
+	}
+
+	blocks = append(blocks, slackBlock{Type: "section", Fields: fields})
+
+	return slackMessage{
+		// the text is shown in the notifications, where blocks are not rendered
+		Text:     title,
+		Channel:  n.slack.Channel,
+		Username: n.slack.Username,
+		Blocks:   blocks,
+	}
+}
+
+// truncateRunes cuts the text to max characters, rather than bytes like truncate,
+// ending it with an ellipsis when it is cut.
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+
+	return string(runes[:max-1]) + "…"
+}
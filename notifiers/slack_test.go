@@ -0,0 +1,129 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"hawkeye/collector/aggregator"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// captured is a webhook stand-in, keeping the last request and body it was posted.
+type captured struct {
+	header http.Header
+	body   []byte
+}
+
+func (c *captured) server(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.header = r.Header.Clone()
+		c.body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+var testAlert = map[string]interface{}{
+	ValueMetric:    "http.response.500",
+	ValueValue:     float32(37),
+	ValueThreshold: float32(10),
+	ValueTags:      "route:/pay",
+	ValueCount:     "http.response.500{route:/pay} is 37, over 10 in prod",
+}
+
+func sendSlack(t *testing.T, channel aggregator.Channel, values map[string]interface{}) slackMessage {
+	t.Helper()
+
+	var c captured
+	channel.Slack = &aggregator.SlackConfig{WebhookURL: c.server(t).URL, Channel: "#oncall", Username: "hawkeye"}
+
+	n, err := NewSlackNotifier(channel, NotifierConfig{Environment: "prod"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := n.Send(context.Background(), values); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	var msg slackMessage
+	if err := json.Unmarshal(c.body, &msg); err != nil {
+		t.Fatalf("invalid slack message %s: %v", c.body, err)
+	}
+
+	return msg
+}
+
+func TestSlackMessage(t *testing.T) {
+	msg := sendSlack(t, aggregator.Channel{}, testAlert)
+
+	if msg.Text != "http.response.500 alert in prod" || msg.Channel != "#oncall" || msg.Username != "hawkeye" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	if len(msg.Blocks) != 3 {
+		t.Fatalf("expected a header, the description and the fields, got %+v", msg.Blocks)
+	}
+
+	header, description, fields := msg.Blocks[0], msg.Blocks[1], msg.Blocks[2]
+
+	if header.Type != "header" || header.Text.Type != "plain_text" || header.Text.Text != msg.Text {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	if description.Text.Text != testAlert[ValueCount] {
+		t.Errorf("expected the description, got %+v", description.Text)
+	}
+
+	expected := []string{"*Metric*\nhttp.response.500", "*Value*\n37.000", "*Threshold*\n10.000", "*Env*\nprod", "*Tags*\nroute:/pay"}
+	for i, field := range fields.Fields {
+		if field.Type != "mrkdwn" || field.Text != expected[i] {
+			t.Errorf("expected field %q, got %+v", expected[i], field)
+		}
+	}
+}
+
+func TestSlackMessageResolved(t *testing.T) {
+	values := map[string]interface{}{ValueState: StateResolved}
+	for key, value := range testAlert {
+		values[key] = value
+	}
+
+	text := "{{ .metric }} is on fire"
+	msg := sendSlack(t, aggregator.Channel{Subject: "checkout errors", Text: &text}, values)
+
+	if msg.Text != "[RESOLVED] checkout errors" {
+		t.Errorf("expected the state in the title, got %q", msg.Text)
+	}
+
+	// the text template is for the alert, the resolve has the description
+	if msg.Blocks[1].Text.Text != testAlert[ValueCount] {
+		t.Errorf("expected the description, got %q", msg.Blocks[1].Text.Text)
+	}
+}
+
+func TestSlackHeaderIsTruncated(t *testing.T) {
+	subject := strings.Repeat("ü", 200)
+	msg := sendSlack(t, aggregator.Channel{Subject: subject}, testAlert)
+
+	header := msg.Blocks[0].Text.Text
+	if n := utf8.RuneCountInString(header); n != slackHeaderMaxLength {
+		t.Errorf("expected the header to be cut to %d characters, got %d", slackHeaderMaxLength, n)
+	}
+
+	if !strings.HasSuffix(header, "…") || !strings.HasPrefix(header, strings.Repeat("ü", 149)) {
+		t.Errorf("unexpected header %q", header)
+	}
+
+	// the notification text is not limited
+	if msg.Text != subject {
+		t.Errorf("expected the whole subject as the text, got %q", msg.Text)
+	}
+}
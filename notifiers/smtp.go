@@ -0,0 +1,389 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+	SMTPAuthNone  = "none"
+)
+
+const DefaultSMTPTimeout = 30 * time.Second
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// Auth is plain or login, defaults to plain when a username is set.
+	Auth string
+	// TLS is starttls, tls (implicit) or none, defaults to starttls.
+	TLS string
+	// Sender is used when the MailerConfig does not have one.
+	Sender    string
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+}
+
+// SMTPMailer sends the emails directly to a mail relay. The connection is kept
+// open and reused for the next emails, until the server closes it.
+type SMTPMailer struct {
+	cfg SMTPConfig
+
+	mu     sync.Mutex
+	conn   net.Conn
+	client *smtp.Client
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	if cfg.TLS == "" {
+		cfg.TLS = SMTPTLSStartTLS
+	}
+
+	if cfg.Auth == "" && cfg.Username != "" {
+		cfg.Auth = SMTPAuthPlain
+	}
+
+	if cfg.Port == 0 {
+		switch cfg.TLS {
+		case SMTPTLSImplicit:
+			cfg.Port = 465
+		case SMTPTLSStartTLS:
+			cfg.Port = 587
+		default:
+			cfg.Port = 25
+		}
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultSMTPTimeout
+	}
+
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{ServerName: cfg.Host}
+	}
+
+	return &SMTPMailer{cfg: cfg}
+}
+
+var (
+	ErrNoRecipients       = errors.New("no_recipients")
+	ErrNoSender           = errors.New("no_sender")
+	ErrStartTLSNotOffered = errors.New("starttls_not_offered")
+	ErrUnsupportedAuth    = errors.New("unsupported_smtp_auth")
+	ErrUnsupportedTLS     = errors.New("unsupported_smtp_tls")
+)
+
+func (s *SMTPMailer) Send(ctx context.Context, cfg MailerConfig) error {
+	sender := cfg.Sender
+	if sender == "" {
+		sender = s.cfg.Sender
+	}
+
+	if sender == "" {
+		return ErrNoSender
+	}
+
+	recipients := append(append(append([]string{}, cfg.Recipients...), cfg.CC...), cfg.Bcc...)
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	msg, err := buildMessage(sender, cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.send(client, sender, recipients, msg); err != nil {
+		// the connection is in an unknown state, the next email gets a new one
+		s.reset()
+		return err
+	}
+
+	log.Println("emails sent to ", len(recipients), " recipients")
+	return nil
+}
+
+// Close ends the open connection, if any.
+func (s *SMTPMailer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == nil {
+		return nil
+	}
+
+	err := s.client.Quit()
+	s.client, s.conn = nil, nil
+	return err
+}
+
+func (s *SMTPMailer) send(client *smtp.Client, sender string, recipients []string, msg []byte) error {
+	if err := client.Mail(sender); err != nil {
+		return err
+	}
+
+	for _, to := range recipients {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// connection returns the open connection if it is still alive, or dials a new one.
+func (s *SMTPMailer) connection(ctx context.Context) (*smtp.Client, error) {
+	deadline := time.Now().Add(s.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	if s.client != nil {
+		s.conn.SetDeadline(deadline)
+
+		if err := s.client.Noop(); err == nil {
+			return s.client, nil
+		}
+
+		s.reset()
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Deadline: deadline}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	switch s.cfg.TLS {
+	case SMTPTLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.cfg.TLSConfig)
+	case SMTPTLSStartTLS, SMTPTLSNone:
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	default:
+		return nil, ErrUnsupportedTLS
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := s.setup(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	s.conn, s.client = conn, client
+	return client, nil
+}
+
+func (s *SMTPMailer) setup(client *smtp.Client) error {
+	if s.cfg.TLS == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSNotOffered
+		}
+
+		if err := client.StartTLS(s.cfg.TLSConfig); err != nil {
+			return err
+		}
+	}
+
+	switch s.cfg.Auth {
+	case "", SMTPAuthNone:
+		return nil
+	case SMTPAuthPlain:
+		return client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host))
+	case SMTPAuthLogin:
+		return client.Auth(&loginAuth{username: s.cfg.Username, password: s.cfg.Password, host: s.cfg.Host})
+	}
+
+	return ErrUnsupportedAuth
+}
+
+func (s *SMTPMailer) reset() {
+	if s.client != nil {
+		s.client.Close()
+	}
+
+	s.client, s.conn = nil, nil
+}
+
+// loginAuth is the LOGIN mechanism, which is not in net/smtp. Like smtp.PlainAuth
+// it only sends the credentials over tls, or to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	isLocal := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !isLocal {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+}
+
+// buildMessage builds the email with the headers, the Bcc recipients are left out.
+// With a html body, the email is multipart/alternative with both the text and html.
+func buildMessage(sender string, cfg MailerConfig) ([]byte, error) {
+	header := textproto.MIMEHeader{}
+	header.Set("From", sender)
+	header.Set("To", strings.Join(cfg.Recipients, ", "))
+	if len(cfg.CC) > 0 {
+		header.Set("Cc", strings.Join(cfg.CC, ", "))
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", cfg.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID(sender))
+	header.Set("MIME-Version", "1.0")
+
+	var body bytes.Buffer
+
+	if cfg.HTMLBody == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		if err := writeQuotedPrintable(&body, cfg.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		mw := multipart.NewWriter(&body)
+		header.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+
+		parts := []struct {
+			contentType string
+			content     string
+		}{
+			{"text/plain; charset=utf-8", cfg.Body},
+			{"text/html; charset=utf-8", cfg.HTMLBody},
+		}
+
+		for _, part := range parts {
+			w, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if err := writeQuotedPrintable(w, part.content); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	var msg bytes.Buffer
+	writeHeader(&msg, header)
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Cc", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(content)); err != nil {
+		return err
+	}
+
+	return qw.Close()
+}
+
+func messageID(sender string) string {
+	domain := "hawkeye"
+	if _, d, found := strings.Cut(sender, "@"); found {
+		domain = strings.Trim(d, "> ")
+	}
+
+	b := make([]byte, 12)
+	rand.Read(b)
+
+	return fmt.Sprintf("<%x.%d@%s>", b, time.Now().UnixNano(), domain)
+}
@@ -0,0 +1,194 @@
+package notifiers
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func readMessage(t *testing.T, cfg MailerConfig) *mail.Message {
+	t.Helper()
+
+	raw, err := buildMessage("Hawkeye <hawkeye@example.com>", cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to read the message: %v\n%s", err, raw)
+	}
+
+	return msg
+}
+
+func TestBuildMessageHeaders(t *testing.T) {
+	msg := readMessage(t, MailerConfig{
+		Subject:    "cpu high",
+		Body:       "cpu is 95%",
+		Recipients: []string{"oncall@example.com", "sre@example.com"},
+		CC:         []string{"lead@example.com"},
+		Bcc:        []string{"audit@example.com"},
+	})
+
+	expected := map[string]string{
+		"From":         "Hawkeye <hawkeye@example.com>",
+		"To":           "oncall@example.com, sre@example.com",
+		"Cc":           "lead@example.com",
+		"Content-Type": "text/plain; charset=utf-8",
+	}
+
+	for key, value := range expected {
+		if got := msg.Header.Get(key); got != value {
+			t.Errorf("expected %s %q, got %q", key, value, got)
+		}
+	}
+
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("expected the message id on the sender domain, got %q", msg.Header.Get("Message-ID"))
+	}
+
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("expected a date, got %v", err)
+	}
+
+	body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if string(body) != "cpu is 95%" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestBuildMessageLeavesOutBcc(t *testing.T) {
+	raw, err := buildMessage("hawkeye@example.com", MailerConfig{
+		Subject:    "cpu high",
+		Body:       "cpu is 95%",
+		Recipients: []string{"oncall@example.com"},
+		Bcc:        []string{"audit@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if bytes.Contains(raw, []byte("audit@example.com")) || bytes.Contains(bytes.ToLower(raw), []byte("bcc")) {
+		t.Errorf("expected the bcc recipients to be left out, got\n%s", raw)
+	}
+}
+
+func TestBuildMessageEncodesSubject(t *testing.T) {
+	subject := "Größe über 95% — http.response.500{route:/pay}"
+	msg := readMessage(t, MailerConfig{Subject: subject, Body: "body", Recipients: []string{"oncall@example.com"}})
+
+	encoded := msg.Header.Get("Subject")
+	if !strings.HasPrefix(encoded, "=?utf-8?q?") {
+		t.Errorf("expected a Q-encoded subject, got %q", encoded)
+	}
+
+	decoded, err := new(mime.WordDecoder).DecodeHeader(encoded)
+	if err != nil || decoded != subject {
+		t.Errorf("expected the subject %q back, got %q, %v", subject, decoded, err)
+	}
+
+	plain := readMessage(t, MailerConfig{Subject: "cpu high", Body: "body", Recipients: []string{"oncall@example.com"}})
+	if got := plain.Header.Get("Subject"); got != "cpu high" {
+		t.Errorf("expected an ascii subject as is, got %q", got)
+	}
+}
+
+func TestBuildMessageMultipart(t *testing.T) {
+	msg := readMessage(t, MailerConfig{
+		Subject:    "cpu high",
+		Body:       "cpu is 95% on web-1",
+		HTMLBody:   "<p>cpu is <b>95%</b> on web-1</p>",
+		Recipients: []string{"oncall@example.com"},
+	})
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q, %v", mediaType, err)
+	}
+
+	expected := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", "cpu is 95% on web-1"},
+		{"text/html; charset=utf-8", "<p>cpu is <b>95%</b> on web-1</p>"},
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for i, part := range expected {
+		p, err := reader.NextRawPart()
+		if err != nil {
+			t.Fatalf("expected part %d, got %v", i, err)
+		}
+
+		if got := p.Header.Get("Content-Type"); got != part.contentType {
+			t.Errorf("expected part %d to be %s, got %s", i, part.contentType, got)
+		}
+
+		content, _ := io.ReadAll(quotedprintable.NewReader(p))
+		if string(content) != part.content {
+			t.Errorf("expected part %d to be %q, got %q", i, part.content, content)
+		}
+	}
+
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected 2 parts, got %v", err)
+	}
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "hawkeye", password: "secret", host: "smtp.example.com"}
+
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	if err != nil || mechanism != "LOGIN" {
+		t.Fatalf("expected LOGIN, got %q, %v", mechanism, err)
+	}
+
+	challenges := []struct {
+		challenge string
+		response  string
+	}{
+		{"Username:", "hawkeye"},
+		{"Password:", "secret"},
+		{" password ", "secret"},
+	}
+
+	for _, c := range challenges {
+		response, err := auth.Next([]byte(c.challenge), true)
+		if err != nil || string(response) != c.response {
+			t.Errorf("%q: expected %q, got %q, %v", c.challenge, c.response, response, err)
+		}
+	}
+
+	if _, err := auth.Next([]byte("Domain:"), true); err == nil {
+		t.Error("expected an unexpected challenge to fail")
+	}
+
+	if response, err := auth.Next(nil, false); response != nil || err != nil {
+		t.Errorf("expected nothing once the server is done, got %q, %v", response, err)
+	}
+}
+
+func TestLoginAuthNeedsTLS(t *testing.T) {
+	auth := &loginAuth{username: "hawkeye", password: "secret", host: "smtp.example.com"}
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com"}); err == nil {
+		t.Error("expected the credentials not to be sent without tls")
+	}
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true}); err == nil {
+		t.Error("expected the credentials not to be sent to another host")
+	}
+
+	local := &loginAuth{username: "hawkeye", password: "secret", host: "localhost"}
+	if _, _, err := local.Start(&smtp.ServerInfo{Name: "localhost"}); err != nil {
+		t.Errorf("expected localhost without tls to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultThrottleInterval is used when the trigger does not have a run_every. It is
+// short, only to keep the replicas of the agent from sending the same notification.
+const DefaultThrottleInterval = time.Minute
+
+// throttledStates are the states notified for a group, a notification of one of them
+// releases the throttle of the others.
+var throttledStates = []State{StateAlerting, StateResolved, StateNoData}
+
+const ThrottleCacheKeyPrefix = "notify::"
+
+// ThrottleStore remembers the notifications sent, for the throttle interval.
+type ThrottleStore interface {
+	// Acquire records the key for the ttl, it is false if the key is already recorded.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Release forgets the key, when the notification could not be sent.
+	Release(ctx context.Context, key string) error
+}
+
+// ThrottledNotifier sends the same notification at most once every interval, for each
+// monitor, trigger, channel, group and state. Sending a state releases the throttle of
+// the other states of the group, so only repeats of the same transition are throttled:
+// an alert which resolves and alerts again within the interval is notified again.
+// With a RedisThrottleStore, replicas of the agent share the throttle, so only
+// one of them sends the notification.
+type ThrottledNotifier struct {
+	notifier Notifier
+	store    ThrottleStore
+	interval time.Duration
+	config   NotifierConfig
+}
+
+func NewThrottledNotifier(notifier Notifier, store ThrottleStore, interval time.Duration, cfg NotifierConfig) *ThrottledNotifier {
+	if interval <= 0 {
+		interval = DefaultThrottleInterval
+	}
+
+	return &ThrottledNotifier{
+		notifier: notifier,
+		store:    store,
+		interval: interval,
+		config:   cfg,
+	}
+}
+
+func (t *ThrottledNotifier) Send(ctx context.Context, values map[string]interface{}) error {
+	return t.throttle(ctx, values, t.notifier.Send)
+}
+
+// Resolve resolves with the wrapped notifier, if it can resolve, otherwise it is sent.
+func (t *ThrottledNotifier) Resolve(ctx context.Context, values map[string]interface{}) error {
+	resolver, ok := t.notifier.(Resolver)
+	if !ok {
+		return t.Send(ctx, values)
+	}
+
+	return t.throttle(ctx, values, resolver.Resolve)
+}
+
+func (t *ThrottledNotifier) throttle(
+	ctx context.Context,
+	values map[string]interface{},
+	send func(context.Context, map[string]interface{}) error,
+) error {
+	alert := alertOf(values, t.config)
+	key := t.key(alert, alert.State)
+
+	ok, err := t.store.Acquire(ctx, key, t.interval)
+	if err != nil {
+		// better to notify twice, than to miss the alert
+		log.Println("failed to throttle notification, sending anyway ", err)
+	} else if !ok {
+		log.Println("notification throttled ", key)
+		return nil
+	}
+
+	if err := send(ctx, values); err != nil {
+		t.release(ctx, key)
+		return err
+	}
+
+	// the next transition of the group is a new notification, not a repeat
+	for _, state := range throttledStates {
+		if state != alert.State {
+			t.release(ctx, t.key(alert, state))
+		}
+	}
+
+	return nil
+}
+
+func (t *ThrottledNotifier) release(ctx context.Context, key string) {
+	if err := t.store.Release(ctx, key); err != nil {
+		log.Println("failed to release throttle ", key, err)
+	}
+}
+
+// key is unique for the monitor ID, so monitors of the same metric do not throttle each other.
+func (t *ThrottledNotifier) key(alert alert, state State) string {
+	return fmt.Sprintf(
+		"%s%s::%s::%d::%d::%s::%s",
+		ThrottleCacheKeyPrefix, t.config.Environment, t.config.MonitorID, t.config.Trigger, t.config.Channel, alert.Tags, state,
+	)
+}
+
+// MemoryThrottleStore keeps the throttle in the agent, it is enough for a single agent.
+type MemoryThrottleStore struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func NewMemoryThrottleStore() *MemoryThrottleStore {
+	return &MemoryThrottleStore{until: map[string]time.Time{}}
+}
+
+func (m *MemoryThrottleStore) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := m.until[key]; ok && now.Before(until) {
+		return false, nil
+	}
+
+	m.until[key] = now.Add(ttl)
+
+	// the expired keys are dropped here, there are only a few per trigger
+	for k, until := range m.until {
+		if !now.Before(until) {
+			delete(m.until, k)
+		}
+	}
+
+	return true, nil
+}
+
+func (m *MemoryThrottleStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.until, key)
+	return nil
+}
+
+// RedisThrottleStore keeps the throttle in redis, with SET NX PX, to share it between replicas.
+type RedisThrottleStore struct {
+	client *redis.Client
+}
+
+func NewRedisThrottleStore(client *redis.Client) *RedisThrottleStore {
+	return &RedisThrottleStore{client: client}
+}
+
+func (r *RedisThrottleStore) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, time.Now().Unix(), ttl).Result()
+}
+
+func (r *RedisThrottleStore) Release(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
@@ -0,0 +1,154 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// sent is a notifier stand-in, recording the states it was sent and failing with err.
+type sent struct {
+	states []State
+	err    error
+}
+
+func (s *sent) Send(_ context.Context, values map[string]interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.states = append(s.states, values[ValueState].(State))
+	return nil
+}
+
+var throttleConfig = NotifierConfig{Environment: "prod", Monitor: "http.response.500", MonitorID: "checkout_5xx"}
+
+func TestThrottleRepeats(t *testing.T) {
+	n := &sent{}
+	throttled := NewThrottledNotifier(n, NewMemoryThrottleStore(), time.Minute, throttleConfig)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := throttled.Send(ctx, alertFor("route:/pay", StateAlerting)); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	if len(n.states) != 1 {
+		t.Errorf("expected the repeats to be throttled, got %v", n.states)
+	}
+}
+
+func TestThrottleInterval(t *testing.T) {
+	n := &sent{}
+	throttled := NewThrottledNotifier(n, NewMemoryThrottleStore(), 20*time.Millisecond, throttleConfig)
+
+	ctx := context.Background()
+	throttled.Send(ctx, alertFor("route:/pay", StateAlerting))
+	time.Sleep(30 * time.Millisecond)
+	throttled.Send(ctx, alertFor("route:/pay", StateAlerting))
+
+	if len(n.states) != 2 {
+		t.Errorf("expected a repeat after the interval to be sent, got %v", n.states)
+	}
+}
+
+func TestThrottleStateChanges(t *testing.T) {
+	n := &sent{}
+	throttled := NewThrottledNotifier(n, NewMemoryThrottleStore(), time.Minute, throttleConfig)
+
+	ctx := context.Background()
+	for _, state := range []State{StateAlerting, StateResolved, StateAlerting, StateNoData, StateAlerting, StateAlerting} {
+		if err := throttled.Send(ctx, alertFor("route:/pay", state)); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	// each change is sent, even back to a state sent within the interval, only the last repeat is not
+	expected := []State{StateAlerting, StateResolved, StateAlerting, StateNoData, StateAlerting}
+	if len(n.states) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, n.states)
+	}
+
+	for i := range expected {
+		if n.states[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, n.states)
+			break
+		}
+	}
+}
+
+func TestThrottleResolveWithoutResolver(t *testing.T) {
+	n := &sent{}
+	throttled := NewThrottledNotifier(n, NewMemoryThrottleStore(), time.Minute, throttleConfig)
+
+	ctx := context.Background()
+	throttled.Resolve(ctx, alertFor("route:/pay", StateResolved))
+	throttled.Resolve(ctx, alertFor("route:/pay", StateResolved))
+
+	if len(n.states) != 1 {
+		t.Errorf("expected the resolve to be sent once, got %v", n.states)
+	}
+}
+
+func TestThrottleKeys(t *testing.T) {
+	store := NewMemoryThrottleStore()
+	ctx := context.Background()
+
+	other := func(change func(cfg *NotifierConfig)) NotifierConfig {
+		cfg := throttleConfig
+		change(&cfg)
+		return cfg
+	}
+
+	tests := []struct {
+		name string
+		cfg  NotifierConfig
+		tags string
+	}{
+		{"first", throttleConfig, "route:/pay"},
+		{"group", throttleConfig, "route:/refund"},
+		{"untagged group", throttleConfig, ""},
+		{"channel", other(func(cfg *NotifierConfig) { cfg.Channel = 1 }), "route:/pay"},
+		{"trigger", other(func(cfg *NotifierConfig) { cfg.Trigger = 1 }), "route:/pay"},
+		{"monitor", other(func(cfg *NotifierConfig) { cfg.MonitorID = "checkout_5xx_eu" }), "route:/pay"},
+		{"environment", other(func(cfg *NotifierConfig) { cfg.Environment = "staging" }), "route:/pay"},
+	}
+
+	// all share the store, but none of them throttles the others
+	for _, tt := range tests {
+		n := &sent{}
+		throttled := NewThrottledNotifier(n, store, time.Minute, tt.cfg)
+
+		throttled.Send(ctx, alertFor(tt.tags, StateAlerting))
+		if len(n.states) != 1 {
+			t.Errorf("%s: expected the alert to be sent, got %v", tt.name, n.states)
+		}
+
+		throttled.Send(ctx, alertFor(tt.tags, StateAlerting))
+		if len(n.states) != 1 {
+			t.Errorf("%s: expected the repeat to be throttled, got %v", tt.name, n.states)
+		}
+	}
+}
+
+func TestThrottleReleasesOnFailure(t *testing.T) {
+	n := &sent{err: errors.New("unavailable")}
+	throttled := NewThrottledNotifier(n, NewMemoryThrottleStore(), time.Minute, throttleConfig)
+
+	ctx := context.Background()
+	if err := throttled.Send(ctx, alertFor("route:/pay", StateAlerting)); !errors.Is(err, n.err) {
+		t.Fatalf("expected the error of the notifier, got %v", err)
+	}
+
+	// the failed notification is not a repeat
+	n.err = nil
+	if err := throttled.Send(ctx, alertFor("route:/pay", StateAlerting)); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if len(n.states) != 1 {
+		t.Errorf("expected the retry to be sent, got %v", n.states)
+	}
+}
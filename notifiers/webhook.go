@@ -0,0 +1,128 @@
+package notifiers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hawkeye/collector/aggregator"
+	"hawkeye/quiver"
+	"log"
+	"net/http"
+	"os"
+)
+
+// SignatureHeader has the hex HMAC-SHA256 of the body, keyed by the webhook secret,
+// as "sha256=<hex>". Receivers should compare it in constant time.
+const SignatureHeader = "X-Hawkeye-Signature"
+
+// WebhookNotifier posts the alert as json to any http endpoint.
+type WebhookNotifier struct {
+	config  NotifierConfig
+	url     string
+	header  http.Header
+	secret  []byte
+	subject string
+	text    string
+	client  *http.Client
+}
+
+// WebhookPayload is the json body posted by the WebhookNotifier.
+type WebhookPayload struct {
+	Metric      string      `json:"metric"`
+	Value       float32     `json:"value"`
+	Threshold   float32     `json:"threshold"`
+	Service     string      `json:"service,omitempty"`
+	Env         string      `json:"env"`
+	Tags        quiver.Tags `json:"tags,omitempty"`
+	Severity    string      `json:"severity,omitempty"`
+	Subject     string      `json:"subject,omitempty"`
+	Text        string      `json:"text,omitempty"`
+	Description string      `json:"description"`
+	Timestamp   int64       `json:"timestamp"`
+	State       State       `json:"state,omitempty"`
+	Previous    State       `json:"previous_state,omitempty"`
+	Peak        float32     `json:"peak,omitempty"`
+	Duration    string      `json:"duration,omitempty"`
+}
+
+var ErrMissingWebhookURL = errors.New("missing_webhook_url")
+
+// NewWebhookNotifier builds the notifier from the webhook config of the channel.
+// Environment variables in the url, header values and secret are expanded.
+func NewWebhookNotifier(channel aggregator.Channel, cfg NotifierConfig) (Notifier, error) {
+	if channel.Webhook == nil || channel.Webhook.URL == "" {
+		return nil, ErrMissingWebhookURL
+	}
+
+	header := http.Header{}
+	for key, value := range channel.Webhook.Headers {
+		header.Set(key, os.ExpandEnv(value))
+	}
+
+	text := ""
+	if channel.Text != nil {
+		text = *channel.Text
+	}
+
+	return &WebhookNotifier{
+		config:  cfg,
+		url:     os.ExpandEnv(channel.Webhook.URL),
+		header:  header,
+		secret:  []byte(os.ExpandEnv(channel.Webhook.Secret)),
+		subject: channel.Subject,
+		text:    text,
+		client:  &http.Client{Timeout: DefaultNotificationTimeout},
+	}, nil
+}
+
+func (n *WebhookNotifier) Send(ctx context.Context, values map[string]interface{}) error {
+	alert := alertOf(values, n.config)
+
+	payload := WebhookPayload{
+		Metric:      alert.Metric,
+		Value:       alert.Value,
+		Threshold:   alert.Threshold,
+		Service:     n.config.ServiceName,
+		Env:         alert.Env,
+		Tags:        quiver.ParseTags(alert.Tags),
+		Severity:    alert.Severity,
+		Subject:     n.subject,
+		Description: alert.Description,
+		Timestamp:   alert.At.Unix(),
+		State:       alert.State,
+		Previous:    alert.Previous,
+		Peak:        alert.Peak,
+		Duration:    alert.Duration,
+	}
+
+	if alert.Alerting() && n.text != "" {
+		payload.Text = RenderTextTemplate(n.text, values)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	header := n.header.Clone()
+	if len(n.secret) > 0 {
+		header.Set(SignatureHeader, "sha256="+Sign(n.secret, body))
+	}
+
+	if err := postJSON(ctx, n.client, n.url, header, body, DefaultNotificationRetries, DefaultNotificationBackoff); err != nil {
+		return err
+	}
+
+	log.Println("webhook notification sent for ", alert.Metric)
+	return nil
+}
+
+// Sign is the hex HMAC-SHA256 of the body, keyed by the secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
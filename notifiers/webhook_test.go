@@ -0,0 +1,90 @@
+package notifiers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hawkeye/collector/aggregator"
+	"strings"
+	"testing"
+)
+
+// verify is what a receiver does with the signature header, with only the secret and the body.
+func verify(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func sendWebhook(t *testing.T, webhook aggregator.WebhookConfig) *captured {
+	t.Helper()
+
+	c := &captured{}
+	webhook.URL = c.server(t).URL
+
+	n, err := NewWebhookNotifier(aggregator.Channel{Webhook: &webhook}, NotifierConfig{ServiceName: "checkout", Environment: "prod"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := n.Send(context.Background(), testAlert); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	return c
+}
+
+func TestWebhookSignature(t *testing.T) {
+	t.Setenv("HAWKEYE_WEBHOOK_SECRET", "s3cret")
+
+	c := sendWebhook(t, aggregator.WebhookConfig{
+		Secret:  "${HAWKEYE_WEBHOOK_SECRET}",
+		Headers: map[string]string{"X-Team": "payments"},
+	})
+
+	signature := c.header.Get(SignatureHeader)
+	if !verify("s3cret", c.body, signature) {
+		t.Errorf("expected the receiver to verify %q for %s", signature, c.body)
+	}
+
+	if verify("other", c.body, signature) {
+		t.Error("expected another secret not to verify")
+	}
+
+	if verify("s3cret", append(c.body, ' '), signature) {
+		t.Error("expected a changed body not to verify")
+	}
+
+	if c.header.Get("X-Team") != "payments" || c.header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", c.header)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(c.body, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", c.body, err)
+	}
+
+	if payload.Metric != "http.response.500" || payload.Value != 37 || payload.Service != "checkout" || payload.Tags["route"] != "/pay" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestWebhookWithoutSecretIsNotSigned(t *testing.T) {
+	c := sendWebhook(t, aggregator.WebhookConfig{})
+
+	if signature := c.header.Get(SignatureHeader); signature != "" {
+		t.Errorf("expected no signature without a secret, got %q", signature)
+	}
+}
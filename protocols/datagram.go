@@ -3,13 +3,17 @@ package protocols
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
 )
 
-// Datagram protocol
-// <METRIC_NAME>:<VALUE>|<TYPE>|@<SAMPLE_RATE>|#<TAG_KEY_1>:<TAG_VALUE_1>,<TAG_2>
+// Datagram protocol, compatible with DogStatsD
+// <METRIC_NAME>:<VALUE>[:<VALUE>...]|<TYPE>|@<SAMPLE_RATE>|#<TAG_KEY_1>:<TAG_VALUE_1>,<TAG_2>|c:<CONTAINER_ID>|T<UNIX_TIMESTAMP>
+// The sample rate is optional, it has to be in (0, 1] and defaults to 1
+// Tags without a value (<TAG_2>) have an empty value
+// Set metrics (s) take any string as their value
 
 // Parser logic
 // lexes := splitBy("|")
@@ -18,6 +22,8 @@ import (
 // rest of split, lexes[i]
 // startsWith('@') = sample rate
 // startsWith('#') = tags
+// startsWith('c:') = container id
+// startsWith('T') = timestamp
 // parse each tag = splitBy(",")
 // [key, value] = splitBy(":")
 
@@ -28,17 +34,40 @@ const (
 	MetricTypeCounter
 	MetricTypeGauge
 	MetricTypeHistogram
+	MetricTypeTimer
+	MetricTypeSet
+	MetricTypeDistribution
 
 	MetricInvalid
 )
 
 const (
-	_counterMetric   = "c"
-	_gaugeMetric     = "g"
-	_histogramMetric = "h"
+	_counterMetric      = "c"
+	_gaugeMetric        = "g"
+	_histogramMetric    = "h"
+	_timerMetric        = "ms"
+	_setMetric          = "s"
+	_distributionMetric = "d"
 )
 
-var _metricTypeMap = []string{"", _counterMetric, _gaugeMetric, _histogramMetric}
+var _metricTypeMap = []string{
+	"",
+	_counterMetric,
+	_gaugeMetric,
+	_histogramMetric,
+	_timerMetric,
+	_setMetric,
+	_distributionMetric,
+}
+
+// String is the datagram type of the metric type, like c for counters.
+func (t MetricType) String() string {
+	if t < 0 || t >= MetricInvalid {
+		return ""
+	}
+
+	return _metricTypeMap[t]
+}
 
 func Is(got string, expected MetricType) bool {
 	if expected >= MetricInvalid {
@@ -53,56 +82,121 @@ func Is(got string, expected MetricType) bool {
 type MetricTag map[string]string
 
 type ExtraData struct {
-	SampleRate float64
-	TagList    MetricTag
+	SampleRate  float64
+	TagList     MetricTag
+	ContainerID string
+	// Timestamp is the unix timestamp in seconds the metric was
+	// reported for, 0 when the metric is for the time it is received.
+	Timestamp int64
 }
 
 type Metric struct {
 	Name  string
 	Value float32
-	Type  MetricType
+	// Member is the value of a set metric
+	Member string
+	Type   MetricType
 	ExtraData
 }
 
-func (m Metric) MetricType() string {
+// SampledValue scales the value by the sample rate. A counter sent
+// with a sample rate of 0.1 stands for 10 times its value.
+func (m Metric) SampledValue() float32 {
+	if m.SampleRate <= 0 || m.SampleRate >= 1 {
+		return m.Value
+	}
+
+	return float32(float64(m.Value) / m.SampleRate)
+}
+
+// IsDistribution reports whether the metric is stored as a histogram,
+// timers and distributions are histograms aggregated by the server.
+func (m Metric) IsDistribution() bool {
 	switch m.Type {
-	case MetricTypeCounter:
-		return _counterMetric
-	case MetricTypeGauge:
-		return _gaugeMetric
-	case MetricTypeHistogram:
-		return _histogramMetric
-	default:
+	case MetricTypeHistogram, MetricTypeTimer, MetricTypeDistribution:
+		return true
+	}
+
+	return false
+}
+
+func (m Metric) MetricType() string {
+	if m.Type <= MetricTypeNone || m.Type >= MetricInvalid {
 		return ""
 	}
+
+	return _metricTypeMap[m.Type]
 }
 
 var ErrInvalidDatagramProtocol = errors.New("invalid_datagram")
 
+var ErrMultipleMetricValues = errors.New("multiple_metric_values")
+
+// ParseDatagram parses a single metric. Datagrams packing multiple values
+// are rejected with ErrMultipleMetricValues, use ParsePacket for them.
 func ParseDatagram(ctx context.Context, value string) (m Metric, err error) {
-	grams := strings.Split(value, "|")
-	if len(grams) < 2 {
-		err = ErrInvalidDatagramProtocol
+	metrics, err := parseMetrics(ctx, value)
+	if err != nil {
 		return
 	}
 
-	m, err = parseMetricInfo(ctx, grams[0])
-	if err != nil {
+	if len(metrics) != 1 {
+		err = ErrMultipleMetricValues
 		return
 	}
+
+	return metrics[0], nil
+}
+
+// parseMetrics parses a metric datagram, returning a metric for every packed value.
+func parseMetrics(ctx context.Context, value string) ([]Metric, error) {
+	grams := strings.Split(value, "|")
+	if len(grams) < 2 {
+		return nil, ErrInvalidDatagramProtocol
+	}
+
 	mType, err := parseMetricType(ctx, grams[1])
 	if err != nil {
-		return m, err
+		return nil, err
 	}
 
-	m.Type = mType
+	name, values, err := parseMetricInfo(ctx, grams[0], mType)
+	if err != nil {
+		return nil, err
+	}
+
+	ex := ExtraData{SampleRate: 1}
 
 	hasMoreData := len(grams) > 2
 	if hasMoreData {
-		m.ExtraData = parseExtra(ctx, grams...)
+		ex, err = parseExtra(ctx, grams[2:]...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return
+	metrics := make([]Metric, 0, len(values))
+
+	for _, v := range values {
+		m := Metric{Name: name, Type: mType, ExtraData: ex}
+
+		if mType == MetricTypeSet {
+			m.Member = v
+			m.Value = 1
+			metrics = append(metrics, m)
+			continue
+		}
+
+		metricVal, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return nil, ErrInvalidMetricValueType
+		}
+
+		m.Value = float32(metricVal)
+		metrics = append(metrics, m)
+	}
+
+	return metrics, nil
 }
 
 var (
@@ -110,67 +204,92 @@ var (
 	ErrInvalidMetricValueType = errors.New("invalid_type_for_metric_value")
 )
 
-func parseMetricInfo(ctx context.Context, metricInfo string) (m Metric, err error) {
+func parseMetricInfo(ctx context.Context, metricInfo string, mType MetricType) (string, []string, error) {
 	splits := strings.Split(metricInfo, ":")
-	if len(splits) != 2 {
-		err = ErrMalformedMetricKey
-		return
+	if len(splits) < 2 || splits[0] == "" {
+		return "", nil, ErrMalformedMetricKey
 	}
 
-	metricVal, err := strconv.ParseFloat(splits[1], 32)
-	if err != nil {
-		err = ErrInvalidMetricValueType
-		return
+	// a set member can have ":" in it, so it is never packed
+	if mType == MetricTypeSet {
+		return splits[0], []string{strings.Join(splits[1:], ":")}, nil
 	}
 
-	m = Metric{Name: splits[0], Value: float32(metricVal)}
-	return
+	return splits[0], splits[1:], nil
 }
 
 var (
 	ErrUnsupportedMetricType = errors.New("unsupported_metric_type")
 )
 
+// ParseMetricType returns the metric type for its datagram form, eg. "c" for counters.
+func ParseMetricType(mType string) (MetricType, error) {
+	return parseMetricType(context.Background(), mType)
+}
+
 func parseMetricType(ctx context.Context, mType string) (MetricType, error) {
-	switch mType {
-	case _counterMetric:
-		return MetricTypeCounter, nil
-	case _gaugeMetric:
-		return MetricTypeGauge, nil
-	case _histogramMetric:
-		return MetricTypeHistogram, nil
+	for i, t := range _metricTypeMap {
+		if t != "" && t == mType {
+			return MetricType(i), nil
+		}
 	}
 
 	return MetricTypeNone, ErrUnsupportedMetricType
 }
 
-func parseExtra(ctx context.Context, rest ...string) ExtraData {
-	ex := ExtraData{}
+var (
+	ErrInvalidSampleRate = errors.New("invalid_sample_rate")
+	ErrInvalidTimestamp  = errors.New("invalid_timestamp")
+)
+
+func parseExtra(ctx context.Context, rest ...string) (ExtraData, error) {
+	ex := ExtraData{SampleRate: 1}
 
 	for _, gram := range rest {
-		if strings.HasPrefix(gram, "@") {
+		switch {
+		case strings.HasPrefix(gram, "@"):
 			sampleRate, err := strconv.ParseFloat(strings.TrimPrefix(gram, "@"), 64)
-			if err == nil {
-				ex.SampleRate = sampleRate
+			if err != nil || sampleRate <= 0 || sampleRate > 1 {
+				return ex, fmt.Errorf("%w %q, expected a rate in (0, 1]", ErrInvalidSampleRate, gram)
 			}
 
-			continue
-		}
+			ex.SampleRate = sampleRate
 
-		if strings.HasPrefix(gram, "#") {
-			tagStr := strings.TrimPrefix(gram, "#")
-			tagMap := map[string]string{}
+		case strings.HasPrefix(gram, "#"):
+			ex.TagList = parseTags(strings.TrimPrefix(gram, "#"))
 
-			for _, tag := range strings.Split(tagStr, ",") {
-				kvp := strings.Split(tag, ":")
-				if len(kvp) == 2 {
-					tagMap[kvp[0]] = kvp[1]
-				}
+		case strings.HasPrefix(gram, "c:"):
+			ex.ContainerID = strings.TrimPrefix(gram, "c:")
+
+		case strings.HasPrefix(gram, "T"):
+			timestamp, err := strconv.ParseInt(strings.TrimPrefix(gram, "T"), 10, 64)
+			if err != nil || timestamp <= 0 {
+				return ex, fmt.Errorf("%w %q", ErrInvalidTimestamp, gram)
 			}
 
-			ex.TagList = tagMap
+			ex.Timestamp = timestamp
+		}
+	}
+
+	return ex, nil
+}
+
+func parseTags(tagStr string) MetricTag {
+	tagMap := map[string]string{}
+
+	for _, tag := range strings.Split(tagStr, ",") {
+		if tag == "" {
+			continue
 		}
+
+		kvp := strings.SplitN(tag, ":", 2)
+		if len(kvp) == 2 {
+			tagMap[kvp[0]] = kvp[1]
+			continue
+		}
+
+		tagMap[kvp[0]] = ""
 	}
 
-	return ex
+	return tagMap
 }
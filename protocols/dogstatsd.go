@@ -0,0 +1,242 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Besides metrics, a packet can have events and service checks, one per line
+// _e{<TITLE_LENGTH>,<TEXT_LENGTH>}:<TITLE>|<TEXT>|d:<TIMESTAMP>|h:<HOSTNAME>|k:<AGGREGATION_KEY>|p:<PRIORITY>|s:<SOURCE_TYPE>|t:<ALERT_TYPE>|#<TAGS>|c:<CONTAINER_ID>
+// _sc|<NAME>|<STATUS>|d:<TIMESTAMP>|h:<HOSTNAME>|#<TAGS>|c:<CONTAINER_ID>|m:<MESSAGE>
+// The lengths are of the utf-8 encoded title and text, new lines in the text are escaped as "\\n"
+
+const (
+	_eventPrefix        = "_e{"
+	_serviceCheckPrefix = "_sc|"
+)
+
+type Event struct {
+	Title          string
+	Text           string
+	Timestamp      int64
+	Hostname       string
+	AggregationKey string
+	Priority       string
+	SourceType     string
+	AlertType      string
+	Tags           MetricTag
+	ContainerID    string
+}
+
+type ServiceCheckStatus int
+
+const (
+	ServiceCheckOK ServiceCheckStatus = iota
+	ServiceCheckWarning
+	ServiceCheckCritical
+	ServiceCheckUnknown
+)
+
+type ServiceCheck struct {
+	Name        string
+	Status      ServiceCheckStatus
+	Timestamp   int64
+	Hostname    string
+	Tags        MetricTag
+	ContainerID string
+	Message     string
+}
+
+// Metric returns the service check as a gauge of its status, so that
+// service checks can be monitored as any other gauge.
+func (sc ServiceCheck) Metric() Metric {
+	return Metric{
+		Name:  sc.Name,
+		Value: float32(sc.Status),
+		Type:  MetricTypeGauge,
+		ExtraData: ExtraData{
+			SampleRate:  1,
+			TagList:     sc.Tags,
+			ContainerID: sc.ContainerID,
+			Timestamp:   sc.Timestamp,
+		},
+	}
+}
+
+type Packet struct {
+	Metrics       []Metric
+	Events        []Event
+	ServiceChecks []ServiceCheck
+}
+
+func (p Packet) IsEmpty() bool {
+	return len(p.Metrics) == 0 && len(p.Events) == 0 && len(p.ServiceChecks) == 0
+}
+
+// ParsePacket parses newline separated metrics, events and service checks.
+// Invalid lines are skipped, the packet has all the valid lines and the
+// error is of the first invalid line.
+func ParsePacket(ctx context.Context, packet string) (Packet, error) {
+	var (
+		p        Packet
+		firstErr error
+	)
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		var err error
+
+		switch {
+		case strings.HasPrefix(line, _eventPrefix):
+			var e Event
+			e, err = ParseEvent(ctx, line)
+			if err == nil {
+				p.Events = append(p.Events, e)
+			}
+
+		case strings.HasPrefix(line, _serviceCheckPrefix):
+			var sc ServiceCheck
+			sc, err = ParseServiceCheck(ctx, line)
+			if err == nil {
+				p.ServiceChecks = append(p.ServiceChecks, sc)
+			}
+
+		default:
+			var metrics []Metric
+			metrics, err = parseMetrics(ctx, line)
+			if err == nil {
+				p.Metrics = append(p.Metrics, metrics...)
+			}
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return p, firstErr
+}
+
+var (
+	ErrMalformedEvent        = errors.New("malformed_event")
+	ErrMalformedServiceCheck = errors.New("malformed_service_check")
+)
+
+func ParseEvent(ctx context.Context, line string) (e Event, err error) {
+	header, rest, found := strings.Cut(strings.TrimPrefix(line, _eventPrefix), "}:")
+	if !found {
+		err = ErrMalformedEvent
+		return
+	}
+
+	titleLen, textLen, found := strings.Cut(header, ",")
+	if !found {
+		err = ErrMalformedEvent
+		return
+	}
+
+	tl, err := strconv.Atoi(titleLen)
+	if err != nil || tl <= 0 {
+		err = ErrMalformedEvent
+		return
+	}
+
+	xl, err := strconv.Atoi(textLen)
+	if err != nil || xl < 0 {
+		err = ErrMalformedEvent
+		return
+	}
+
+	// <TITLE>|<TEXT>
+	if len(rest) < tl+1+xl || rest[tl] != '|' {
+		err = ErrMalformedEvent
+		return
+	}
+
+	e.Title = rest[:tl]
+	e.Text = strings.ReplaceAll(rest[tl+1:tl+1+xl], "\\n", "\n")
+
+	rest = rest[tl+1+xl:]
+	if rest == "" {
+		return
+	}
+
+	if !strings.HasPrefix(rest, "|") {
+		err = ErrMalformedEvent
+		return
+	}
+
+	for _, gram := range strings.Split(rest[1:], "|") {
+		switch {
+		case strings.HasPrefix(gram, "d:"):
+			e.Timestamp, err = strconv.ParseInt(strings.TrimPrefix(gram, "d:"), 10, 64)
+			if err != nil {
+				err = ErrMalformedEvent
+				return
+			}
+		case strings.HasPrefix(gram, "h:"):
+			e.Hostname = strings.TrimPrefix(gram, "h:")
+		case strings.HasPrefix(gram, "k:"):
+			e.AggregationKey = strings.TrimPrefix(gram, "k:")
+		case strings.HasPrefix(gram, "p:"):
+			e.Priority = strings.TrimPrefix(gram, "p:")
+		case strings.HasPrefix(gram, "s:"):
+			e.SourceType = strings.TrimPrefix(gram, "s:")
+		case strings.HasPrefix(gram, "t:"):
+			e.AlertType = strings.TrimPrefix(gram, "t:")
+		case strings.HasPrefix(gram, "c:"):
+			e.ContainerID = strings.TrimPrefix(gram, "c:")
+		case strings.HasPrefix(gram, "#"):
+			e.Tags = parseTags(strings.TrimPrefix(gram, "#"))
+		}
+	}
+
+	return
+}
+
+func ParseServiceCheck(ctx context.Context, line string) (sc ServiceCheck, err error) {
+	grams := strings.Split(strings.TrimPrefix(line, _serviceCheckPrefix), "|")
+	if len(grams) < 2 || grams[0] == "" {
+		err = ErrMalformedServiceCheck
+		return
+	}
+
+	status, err := strconv.Atoi(grams[1])
+	if err != nil || status < int(ServiceCheckOK) || status > int(ServiceCheckUnknown) {
+		err = ErrMalformedServiceCheck
+		return
+	}
+
+	sc.Name = grams[0]
+	sc.Status = ServiceCheckStatus(status)
+
+	for i, gram := range grams[2:] {
+		switch {
+		case strings.HasPrefix(gram, "d:"):
+			sc.Timestamp, err = strconv.ParseInt(strings.TrimPrefix(gram, "d:"), 10, 64)
+			if err != nil {
+				err = ErrMalformedServiceCheck
+				return
+			}
+		case strings.HasPrefix(gram, "h:"):
+			sc.Hostname = strings.TrimPrefix(gram, "h:")
+		case strings.HasPrefix(gram, "c:"):
+			sc.ContainerID = strings.TrimPrefix(gram, "c:")
+		case strings.HasPrefix(gram, "#"):
+			sc.Tags = parseTags(strings.TrimPrefix(gram, "#"))
+		case strings.HasPrefix(gram, "m:"):
+			// the message is always the last field, and can have "|" in it
+			message := strings.Join(grams[2+i:], "|")
+			sc.Message = strings.ReplaceAll(strings.TrimPrefix(message, "m:"), "\\n", "\n")
+			return
+		}
+	}
+
+	return
+}
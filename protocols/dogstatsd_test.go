@@ -0,0 +1,139 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePacket(t *testing.T) {
+	packet := "http.request:1:2|c|@0.5|#route:/pay,canary\r\n" +
+		"users:alice:admin|s\n" +
+		"\n" +
+		"_e{11,15}:deploy done|shipped\\nv1.2.3|d:1700000000|h:web-1|k:deploy|p:low|s:ci|t:success|#env:prod|c:abc\n" +
+		"_sc|db.up|2|d:1700000000|h:db-1|#env:prod|m:down | failing over\\nnow"
+
+	p, err := ParsePacket(context.Background(), packet)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	requests := ExtraData{SampleRate: 0.5, TagList: MetricTag{"route": "/pay", "canary": ""}}
+	expected := Packet{
+		Metrics: []Metric{
+			{Name: "http.request", Value: 1, Type: MetricTypeCounter, ExtraData: requests},
+			{Name: "http.request", Value: 2, Type: MetricTypeCounter, ExtraData: requests},
+			// a set member can have ":" in it
+			{Name: "users", Value: 1, Member: "alice:admin", Type: MetricTypeSet, ExtraData: ExtraData{SampleRate: 1}},
+		},
+		Events: []Event{{
+			Title:          "deploy done",
+			Text:           "shipped\nv1.2.3",
+			Timestamp:      1700000000,
+			Hostname:       "web-1",
+			AggregationKey: "deploy",
+			Priority:       "low",
+			SourceType:     "ci",
+			AlertType:      "success",
+			Tags:           MetricTag{"env": "prod"},
+			ContainerID:    "abc",
+		}},
+		ServiceChecks: []ServiceCheck{{
+			Name:      "db.up",
+			Status:    ServiceCheckCritical,
+			Timestamp: 1700000000,
+			Hostname:  "db-1",
+			Tags:      MetricTag{"env": "prod"},
+			// the message is the last field, with its "|"
+			Message: "down | failing over\nnow",
+		}},
+	}
+
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+}
+
+func TestParsePacketSkipsInvalidLines(t *testing.T) {
+	packet := "cpu:0.5|g\n" +
+		"cpu:high|g\n" +
+		"_sc|db.up|7\n" +
+		"latency:12|ms|T1700000000"
+
+	p, err := ParsePacket(context.Background(), packet)
+
+	// the error is of the first invalid line
+	if !errors.Is(err, ErrInvalidMetricValueType) {
+		t.Errorf("expected ErrInvalidMetricValueType, got %v", err)
+	}
+
+	expected := []Metric{
+		{Name: "cpu", Value: 0.5, Type: MetricTypeGauge, ExtraData: ExtraData{SampleRate: 1}},
+		{Name: "latency", Value: 12, Type: MetricTypeTimer, ExtraData: ExtraData{SampleRate: 1, Timestamp: 1700000000}},
+	}
+
+	if !reflect.DeepEqual(p.Metrics, expected) {
+		t.Errorf("expected the valid metrics %+v, got %+v", expected, p.Metrics)
+	}
+
+	if len(p.ServiceChecks) != 0 {
+		t.Errorf("expected the invalid service check to be skipped, got %+v", p.ServiceChecks)
+	}
+}
+
+func TestParsePacketErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		err  error
+	}{
+		{"http.request", ErrInvalidDatagramProtocol},
+		{"http.request:1|x", ErrUnsupportedMetricType},
+		{":1|c", ErrMalformedMetricKey},
+		{"http.request|c", ErrMalformedMetricKey},
+		{"http.request:1|c|@0", ErrInvalidSampleRate},
+		{"http.request:1|c|@1.5", ErrInvalidSampleRate},
+		{"http.request:1|c|T-1", ErrInvalidTimestamp},
+		{"_e{5,4}:title|tex", ErrMalformedEvent},
+		{"_e{5,4}:titletext", ErrMalformedEvent},
+		{"_e{0,4}:|text", ErrMalformedEvent},
+		{"_e{5,4}:title|text|d:now", ErrMalformedEvent},
+		{"_sc|db.up", ErrMalformedServiceCheck},
+		{"_sc||0", ErrMalformedServiceCheck},
+		{"_sc|db.up|ok", ErrMalformedServiceCheck},
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePacket(context.Background(), tt.line)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected %v, got %v", tt.line, tt.err, err)
+		}
+
+		if !p.IsEmpty() {
+			t.Errorf("%q: expected an empty packet, got %+v", tt.line, p)
+		}
+	}
+}
+
+func TestParseEventUTF8Lengths(t *testing.T) {
+	// the lengths are of the utf-8 bytes, é is 2
+	e, err := ParseEvent(context.Background(), "_e{6,5}:déjà|vu ok")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if e.Title != "déjà" || e.Text != "vu ok" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestParseDatagramRejectsPackedValues(t *testing.T) {
+	if _, err := ParseDatagram(context.Background(), "http.request:1:2|c"); !errors.Is(err, ErrMultipleMetricValues) {
+		t.Errorf("expected ErrMultipleMetricValues, got %v", err)
+	}
+
+	m, err := ParseDatagram(context.Background(), "http.request:3|c")
+	if err != nil || m.Value != 3 || m.SampledValue() != 3 {
+		t.Errorf("expected a single counter of 3, got %+v, %v", m, err)
+	}
+}
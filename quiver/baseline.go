@@ -0,0 +1,132 @@
+package quiver
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+)
+
+const BaselineCacheKeyPrefix = "baseline::"
+
+// Baseline is the exponentially weighted moving average and variance of the values
+// of a series, the normal the anomalies are measured against.
+type Baseline struct {
+	Mean     float64
+	Variance float64
+	// Count is the number of values the baseline was updated with.
+	Count     int64
+	UpdatedAt time.Time
+
+	// PeriodStart is the start of the period the values are added up for, for the
+	// baselines updated once per period. PeriodSum, PeriodSumSquares and PeriodCount
+	// are the values of the period, folded into the baseline when the next one starts.
+	PeriodStart      time.Time
+	PeriodSum        float64
+	PeriodSumSquares float64
+	PeriodCount      int64
+}
+
+// Update adds the value to the baseline, alpha being the weight of the new value.
+func (b Baseline) Update(value, alpha float64, at time.Time) Baseline {
+	if b.Count == 0 {
+		return Baseline{Mean: value, Count: 1, UpdatedAt: at}
+	}
+
+	diff := value - b.Mean
+	incr := alpha * diff
+
+	return Baseline{
+		Mean:      b.Mean + incr,
+		Variance:  (1 - alpha) * (b.Variance + diff*incr),
+		Count:     b.Count + 1,
+		UpdatedAt: at,
+	}
+}
+
+// AddToPeriod adds the value to the period starting at periodStart. The values of an earlier
+// period are first folded into the baseline, as a single value, their mean, so the baseline
+// is updated once per period, and Count is the number of periods. The variance of the
+// values within the period is added to the variance of the baseline, with the same weight.
+func (b Baseline) AddToPeriod(value float64, periodStart time.Time, alpha float64, at time.Time) Baseline {
+	if b.PeriodCount > 0 && !b.PeriodStart.Equal(periodStart) {
+		b = b.fold(alpha)
+	}
+
+	if b.PeriodCount == 0 {
+		b.PeriodStart = periodStart
+	}
+
+	b.PeriodSum += value
+	b.PeriodSumSquares += value * value
+	b.PeriodCount++
+	b.UpdatedAt = at
+
+	return b
+}
+
+// fold updates the baseline with the mean of the values of the period, and starts a new period.
+func (b Baseline) fold(alpha float64) Baseline {
+	n := float64(b.PeriodCount)
+	mean := b.PeriodSum / n
+	within := math.Max(b.PeriodSumSquares/n-mean*mean, 0)
+
+	folded := b.Update(mean, alpha, b.UpdatedAt)
+	if b.Count == 0 {
+		folded.Variance = within
+	} else {
+		folded.Variance += alpha * within
+	}
+
+	return folded
+}
+
+// ZScore is how many standard deviations the value is away from the mean. The
+// deviation is at least minStddev, for a baseline which has not varied yet.
+func (b Baseline) ZScore(value, minStddev float64) float64 {
+	stddev := math.Max(math.Sqrt(b.Variance), minStddev)
+	if stddev == 0 {
+		return 0
+	}
+
+	return (value - b.Mean) / stddev
+}
+
+// GetBaseline returns the baseline stored for the key, the zero baseline if there is none.
+func (rr *RedisRepo) GetBaseline(ctx context.Context, key string) (Baseline, error) {
+	fields, err := rr.client.HGetAll(ctx, BaselineCacheKeyPrefix+key).Result()
+	if err != nil || len(fields) == 0 {
+		return Baseline{}, err
+	}
+
+	b := Baseline{}
+	b.Mean, _ = strconv.ParseFloat(fields["mean"], 64)
+	b.Variance, _ = strconv.ParseFloat(fields["variance"], 64)
+	b.Count, _ = strconv.ParseInt(fields["count"], 10, 64)
+
+	if micros, err := strconv.ParseInt(fields["updated_at"], 10, 64); err == nil {
+		b.UpdatedAt = time.UnixMicro(micros).UTC()
+	}
+
+	if micros, err := strconv.ParseInt(fields["period_start"], 10, 64); err == nil {
+		b.PeriodStart = time.UnixMicro(micros).UTC()
+	}
+	b.PeriodSum, _ = strconv.ParseFloat(fields["period_sum"], 64)
+	b.PeriodSumSquares, _ = strconv.ParseFloat(fields["period_sum_squares"], 64)
+	b.PeriodCount, _ = strconv.ParseInt(fields["period_count"], 10, 64)
+
+	return b, nil
+}
+
+func (rr *RedisRepo) SetBaseline(ctx context.Context, key string, b Baseline) error {
+	return rr.client.HSet(ctx, BaselineCacheKeyPrefix+key,
+		"mean", strconv.FormatFloat(b.Mean, 'g', -1, 64),
+		"variance", strconv.FormatFloat(b.Variance, 'g', -1, 64),
+		"count", b.Count,
+		"updated_at", b.UpdatedAt.UnixMicro(),
+		"period_start", b.PeriodStart.UnixMicro(),
+		"period_sum", strconv.FormatFloat(b.PeriodSum, 'g', -1, 64),
+		"period_sum_squares", strconv.FormatFloat(b.PeriodSumSquares, 'g', -1, 64),
+		"period_count", b.PeriodCount,
+	).Err()
+}
@@ -0,0 +1,127 @@
+package quiver
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBaselineUpdate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// by hand, with alpha 0.5: the diff to the mean, the mean moved by half of it,
+	// and the variance half of the previous one plus the diff times the move
+	tests := []struct {
+		value    float64
+		mean     float64
+		variance float64
+	}{
+		// the first value is the mean
+		{10, 10, 0},
+		// diff 10, mean 10 + 5, variance 0.5 * (0 + 10*5)
+		{20, 15, 25},
+		// diff 1, mean 15 + 0.5, variance 0.5 * (25 + 1*0.5)
+		{16, 15.5, 12.75},
+		// diff -15.5, mean 15.5 - 7.75, variance 0.5 * (12.75 + 15.5*7.75)
+		{0, 7.75, 66.4375},
+	}
+
+	b := Baseline{}
+	for i, tt := range tests {
+		at := start.Add(time.Duration(i) * time.Minute)
+		b = b.Update(tt.value, 0.5, at)
+
+		if !near(b.Mean, tt.mean) || !near(b.Variance, tt.variance) {
+			t.Errorf("%g: expected mean %g and variance %g, got %g and %g", tt.value, tt.mean, tt.variance, b.Mean, b.Variance)
+		}
+
+		if b.Count != int64(i+1) || !b.UpdatedAt.Equal(at) {
+			t.Errorf("%g: expected count %d updated at %v, got %d at %v", tt.value, i+1, at, b.Count, b.UpdatedAt)
+		}
+	}
+}
+
+func TestBaselineAddToPeriod(t *testing.T) {
+	week := 7 * 24 * time.Hour
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	second, third := first.Add(week), first.Add(2*week)
+
+	b := Baseline{}.
+		AddToPeriod(2, first, 0.5, first.Add(time.Minute)).
+		AddToPeriod(4, first, 0.5, first.Add(2*time.Minute))
+
+	// the values of the period are added up, the baseline is not updated yet
+	if b.Count != 0 || b.PeriodCount != 2 || b.PeriodSum != 6 || b.PeriodSumSquares != 20 || !b.PeriodStart.Equal(first) {
+		t.Fatalf("expected the period to have 2 and 4, got %+v", b)
+	}
+
+	// at the boundary, the period is folded as its mean 3, with the variance within it,
+	// 20/2 - 3*3, and the value is the first of the next period
+	b = b.AddToPeriod(10, second, 0.5, second.Add(time.Minute))
+
+	if b.Count != 1 || !near(b.Mean, 3) || !near(b.Variance, 1) {
+		t.Errorf("expected the first period folded to mean 3 and variance 1, got %+v", b)
+	}
+
+	if b.PeriodCount != 1 || b.PeriodSum != 10 || b.PeriodSumSquares != 100 || !b.PeriodStart.Equal(second) {
+		t.Errorf("expected the second period to have 10, got %+v", b)
+	}
+
+	// the second period is folded like a value of 10, diff 7, mean 3 + 3.5,
+	// variance 0.5 * (1 + 7*3.5), and nothing within the period
+	b = b.AddToPeriod(20, third, 0.5, third.Add(time.Minute))
+
+	if b.Count != 2 || !near(b.Mean, 6.5) || !near(b.Variance, 12.75) {
+		t.Errorf("expected the second period folded to mean 6.5 and variance 12.75, got %+v", b)
+	}
+
+	if !b.UpdatedAt.Equal(third.Add(time.Minute)) {
+		t.Errorf("expected the baseline to be updated at the last value, got %v", b.UpdatedAt)
+	}
+}
+
+func TestBaselineFoldVariance(t *testing.T) {
+	// the variance within the period is added with the weight of a new value
+	b := Baseline{Mean: 10, Variance: 4, Count: 5, PeriodCount: 2, PeriodSum: 16, PeriodSumSquares: 136}
+
+	// the period has 6 and 10, mean 8, within 136/2 - 64 = 4, diff -2, mean 10 - 1,
+	// variance 0.5 * (4 + 2*1) + 0.5 * 4
+	folded := b.fold(0.5)
+
+	if folded.Count != 6 || !near(folded.Mean, 9) || !near(folded.Variance, 5) {
+		t.Errorf("expected mean 9 and variance 5, got %+v", folded)
+	}
+
+	if folded.PeriodCount != 0 || folded.PeriodSum != 0 || folded.PeriodSumSquares != 0 {
+		t.Errorf("expected a new period, got %+v", folded)
+	}
+}
+
+func TestBaselineZScore(t *testing.T) {
+	tests := []struct {
+		baseline  Baseline
+		value     float64
+		minStddev float64
+		z         float64
+	}{
+		{Baseline{Mean: 10, Variance: 4}, 16, 0, 3},
+		{Baseline{Mean: 10, Variance: 4}, 4, 0, -3},
+		{Baseline{Mean: 10, Variance: 4}, 10, 0, 0},
+		// the floor is used over a smaller deviation
+		{Baseline{Mean: 10, Variance: 4}, 16, 5, 1.2},
+		{Baseline{Mean: 10, Variance: 4}, 16, 1, 3},
+		// a baseline which has not varied yet
+		{Baseline{Mean: 10}, 16, 0.5, 12},
+		{Baseline{Mean: 10}, 16, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if z := tt.baseline.ZScore(tt.value, tt.minStddev); !near(z, tt.z) {
+			t.Errorf("%g from %+v with min stddev %g: expected %g, got %g", tt.value, tt.baseline, tt.minStddev, tt.z, z)
+		}
+	}
+}
@@ -5,37 +5,73 @@ import (
 	"fmt"
 	"hawkeye/utils"
 	"log"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// Repository stores every metric as series, one per tag set. The ranges are
+// queried with a tag filter, and aggregate over all the series matching it.
+// The ranges return the errors of redis, an empty range is not an error. The Get*Range
+// methods query the last interval, and the Get*Between ones any window, from included to excluded.
 type Repository interface {
-	GetCountRange(ctx context.Context, metric string, interval time.Duration) float32
-	SetCount(ctx context.Context, metric string, key int64, value float32) error
+	GetCountRange(ctx context.Context, metric string, filter Tags, interval time.Duration) (float32, error)
+	GetCountBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) (float32, error)
+	SetCount(ctx context.Context, metric string, tags Tags, key int64, value float32) error
 	DeleteCountRange(ctx context.Context, metric string, interval time.Duration) error
-	// GetGauge()
-	// SetGauge
+	GetGaugeRange(ctx context.Context, metric string, filter Tags, interval time.Duration) ([]float32, error)
+	GetGaugeBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) ([]float32, error)
+	SetGauge(ctx context.Context, metric string, tags Tags, key int64, value float32) error
+	DeleteGaugeRange(ctx context.Context, metric string, interval time.Duration) error
+	GetHistogramRange(ctx context.Context, metric string, filter Tags, interval time.Duration) (*Sketch, error)
+	GetHistogramBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) (*Sketch, error)
+	AddHistogram(ctx context.Context, metric string, tags Tags, key int64, value float32) error
+	DeleteHistogramRange(ctx context.Context, metric string, interval time.Duration) error
+	GetSetRange(ctx context.Context, metric string, filter Tags, interval time.Duration) (float32, error)
+	GetSetBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) (float32, error)
+	AddSetMember(ctx context.Context, metric string, tags Tags, key int64, member string) error
+	DeleteSetRange(ctx context.Context, metric string, interval time.Duration) error
+	Series(ctx context.Context, metric string, filter Tags) ([]Tags, error)
+	LastWrite(ctx context.Context, metric string, filter Tags) (time.Time, error)
+	GetBaseline(ctx context.Context, key string) (Baseline, error)
+	SetBaseline(ctx context.Context, key string, b Baseline) error
 }
 
 type RedisRepo struct {
 	client *redis.Client
 }
 
-const CounterCacheKeySuffix = "::timestamps"
+const (
+	CounterCacheKeySuffix   = "::timestamps"
+	SeriesCacheKeySuffix    = "::series"
+	LastWriteCacheKeySuffix = "::last_write"
+	GaugeCacheKeyPrefix     = "gauge::"
+	HistogramCacheKeyPrefix = "histogram::"
+	SetCacheKeyPrefix       = "set::"
+)
+
+// HistogramSlot is the resolution at which histogram samples and set members are stored.
+// Samples within the same slot are merged into one sketch, and members into one HyperLogLog.
+const HistogramSlot = 10 * time.Second
 
 func NewRedisRepo(client *redis.Client) *RedisRepo {
 	return &RedisRepo{client: client}
 }
 
 // Here key should be time.Now().UTC().Unix()
-func (rr *RedisRepo) SetCount(ctx context.Context, metric string, key int64, value float32) error {
-	fv := fmt.Sprintf("%.3f", value)
-	// strKey := fmt.Sprintf("%d", key)
+// Counts set for the same key are added up, so that concurrent
+// writes in the same microsecond are not lost.
+func (rr *RedisRepo) SetCount(ctx context.Context, metric string, tags Tags, key int64, value float32) error {
+	if err := rr.addSeries(ctx, metric, tags); err != nil {
+		return err
+	}
+
+	series := SeriesKey(metric, tags)
 
 	_, err := rr.client.
-		HSet(ctx, metric, key, fv).
+		HIncrByFloat(ctx, series, strconv.FormatInt(key, 10), float64(value)).
 		Result()
 
 	if err != nil {
@@ -43,26 +79,441 @@ func (rr *RedisRepo) SetCount(ctx context.Context, metric string, key int64, val
 	}
 
 	_, err = rr.client.
-		ZAdd(ctx, metric+CounterCacheKeySuffix, &redis.Z{Score: float64(key), Member: key}).
+		ZAdd(ctx, series+CounterCacheKeySuffix, &redis.Z{Score: float64(key), Member: key}).
 		Result()
 
 	return err
 }
 
-func (rr *RedisRepo) GetCountRange(ctx context.Context, metric string, interval time.Duration) float32 {
+func (rr *RedisRepo) GetCountRange(ctx context.Context, metric string, filter Tags, interval time.Duration) (float32, error) {
 	now := utils.Now()
+	return rr.GetCountBetween(ctx, metric, filter, now.Add(-interval), now)
+}
 
-	rang := &redis.ZRangeBy{
-		Min: strconv.Itoa(int(utils.ToUnix(now.Add(-interval)))),
-		Max: strconv.Itoa(int(utils.ToUnix(now))),
+func (rr *RedisRepo) GetCountBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) (float32, error) {
+	series, err := rr.series(ctx, metric, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var count float64
+
+	for _, tags := range series {
+		points, err := rr.getValueRange(ctx, SeriesKey(metric, tags), from, to)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, p := range points {
+			count += p.value
+		}
 	}
 
-	timestamps, err := rr.client.ZRangeByScoreWithScores(ctx, metric+CounterCacheKeySuffix, rang).Result()
+	// log.Println("total count for", metric, count)
+	return float32(count), nil
+}
+
+func (rr *RedisRepo) DeleteCountRange(ctx context.Context, metric string, interval time.Duration) error {
+	all, err := rr.series(ctx, metric, nil)
 	if err != nil {
-		return 0
+		return err
 	}
 
-	var count float64
+	for _, tags := range all {
+		if err := rr.deleteValueRange(ctx, SeriesKey(metric, tags), interval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetGauge stores the last value reported for a gauge at the given timestamp.
+// A gauge reported twice for the same timestamp keeps the latest value.
+func (rr *RedisRepo) SetGauge(ctx context.Context, metric string, tags Tags, key int64, value float32) error {
+	if err := rr.addSeries(ctx, metric, tags); err != nil {
+		return err
+	}
+
+	return rr.setValue(ctx, GaugeCacheKeyPrefix+SeriesKey(metric, tags), key, value)
+}
+
+// GetGaugeRange returns the gauge values in the interval of all the
+// matching series, ordered from oldest to latest.
+func (rr *RedisRepo) GetGaugeRange(ctx context.Context, metric string, filter Tags, interval time.Duration) ([]float32, error) {
+	now := utils.Now()
+	return rr.GetGaugeBetween(ctx, metric, filter, now.Add(-interval), now)
+}
+
+func (rr *RedisRepo) GetGaugeBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) ([]float32, error) {
+	series, err := rr.series(ctx, metric, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	points := []point{}
+
+	for _, tags := range series {
+		seriesPoints, err := rr.getValueRange(ctx, GaugeCacheKeyPrefix+SeriesKey(metric, tags), from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, seriesPoints...)
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].timestamp < points[j].timestamp
+	})
+
+	gauges := make([]float32, 0, len(points))
+	for _, p := range points {
+		gauges = append(gauges, float32(p.value))
+	}
+
+	return gauges, nil
+}
+
+func (rr *RedisRepo) DeleteGaugeRange(ctx context.Context, metric string, interval time.Duration) error {
+	all, err := rr.series(ctx, metric, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, tags := range all {
+		if err := rr.deleteValueRange(ctx, GaugeCacheKeyPrefix+SeriesKey(metric, tags), interval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddHistogram adds the sample to the sketch of the slot the key falls in.
+// Each slot is a hash of sketch buckets to sample counts.
+func (rr *RedisRepo) AddHistogram(ctx context.Context, metric string, tags Tags, key int64, value float32) error {
+	if err := rr.addSeries(ctx, metric, tags); err != nil {
+		return err
+	}
+
+	series := SeriesKey(metric, tags)
+	slot := key - key%HistogramSlot.Microseconds()
+	field := NewSketch(DefaultSketchAccuracy).Field(float64(value))
+
+	_, err := rr.client.
+		HIncrByFloat(ctx, histogramSlotKey(series, strconv.FormatInt(slot, 10)), field, 1).
+		Result()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = rr.client.
+		ZAdd(ctx, HistogramCacheKeyPrefix+series+CounterCacheKeySuffix, &redis.Z{Score: float64(slot), Member: slot}).
+		Result()
+
+	return err
+}
+
+// GetHistogramRange merges the sketches of all the slots which started
+// in the interval, for all the matching series.
+func (rr *RedisRepo) GetHistogramRange(ctx context.Context, metric string, filter Tags, interval time.Duration) (*Sketch, error) {
+	now := utils.Now()
+	return rr.GetHistogramBetween(ctx, metric, filter, now.Add(-interval), now)
+}
+
+func (rr *RedisRepo) GetHistogramBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) (*Sketch, error) {
+	sketch := NewSketch(DefaultSketchAccuracy)
+	rang := between(from, to)
+
+	matching, err := rr.series(ctx, metric, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tags := range matching {
+		series := SeriesKey(metric, tags)
+
+		slots, err := rr.client.ZRangeByScore(ctx, HistogramCacheKeyPrefix+series+CounterCacheKeySuffix, rang).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, slot := range slots {
+			buckets, err := rr.client.HGetAll(ctx, histogramSlotKey(series, slot)).Result()
+			if err != nil {
+				return nil, err
+			}
+
+			for field, val := range buckets {
+				count, err := strconv.ParseFloat(val, 64)
+				if err != nil {
+					log.Println("failed to convert to float", series, val)
+					continue
+				}
+
+				sketch.AddField(field, count)
+			}
+		}
+	}
+
+	return sketch, nil
+}
+
+func (rr *RedisRepo) DeleteHistogramRange(ctx context.Context, metric string, interval time.Duration) error {
+	upto := strconv.Itoa(int(utils.ToUnix(utils.Now().Add(-interval))))
+
+	all, err := rr.series(ctx, metric, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, tags := range all {
+		series := SeriesKey(metric, tags)
+		key := HistogramCacheKeyPrefix + series + CounterCacheKeySuffix
+
+		slots, err := rr.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: upto}).Result()
+		if err != nil {
+			continue
+		}
+
+		for _, slot := range slots {
+			if err := rr.client.Del(ctx, histogramSlotKey(series, slot)).Err(); err != nil {
+				log.Println("failed to delete histogram slot", series, slot)
+			}
+		}
+
+		if _, err = rr.client.ZRemRangeByScore(ctx, key, "-inf", upto).Result(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func histogramSlotKey(series, slot string) string {
+	return HistogramCacheKeyPrefix + series + "::" + slot
+}
+
+// AddSetMember adds the member to the HyperLogLog of the slot the key falls in.
+func (rr *RedisRepo) AddSetMember(ctx context.Context, metric string, tags Tags, key int64, member string) error {
+	if err := rr.addSeries(ctx, metric, tags); err != nil {
+		return err
+	}
+
+	series := SeriesKey(metric, tags)
+	slot := key - key%HistogramSlot.Microseconds()
+
+	_, err := rr.client.
+		PFAdd(ctx, setSlotKey(series, strconv.FormatInt(slot, 10)), member).
+		Result()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = rr.client.
+		ZAdd(ctx, SetCacheKeyPrefix+series+CounterCacheKeySuffix, &redis.Z{Score: float64(slot), Member: slot}).
+		Result()
+
+	return err
+}
+
+// GetSetRange returns the approximate number of unique members, across the
+// slots which started in the interval, of all the matching series.
+func (rr *RedisRepo) GetSetRange(ctx context.Context, metric string, filter Tags, interval time.Duration) (float32, error) {
+	now := utils.Now()
+	return rr.GetSetBetween(ctx, metric, filter, now.Add(-interval), now)
+}
+
+func (rr *RedisRepo) GetSetBetween(ctx context.Context, metric string, filter Tags, from, to time.Time) (float32, error) {
+	rang := between(from, to)
+
+	matching, err := rr.series(ctx, metric, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{}
+
+	for _, tags := range matching {
+		series := SeriesKey(metric, tags)
+
+		slots, err := rr.client.ZRangeByScore(ctx, SetCacheKeyPrefix+series+CounterCacheKeySuffix, rang).Result()
+		if err != nil {
+			return 0, err
+		}
+
+		for _, slot := range slots {
+			keys = append(keys, setSlotKey(series, slot))
+		}
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	count, err := rr.client.PFCount(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(count), nil
+}
+
+func (rr *RedisRepo) DeleteSetRange(ctx context.Context, metric string, interval time.Duration) error {
+	upto := strconv.Itoa(int(utils.ToUnix(utils.Now().Add(-interval))))
+
+	all, err := rr.series(ctx, metric, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, tags := range all {
+		series := SeriesKey(metric, tags)
+		key := SetCacheKeyPrefix + series + CounterCacheKeySuffix
+
+		slots, err := rr.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: upto}).Result()
+		if err != nil {
+			continue
+		}
+
+		for _, slot := range slots {
+			if err := rr.client.Del(ctx, setSlotKey(series, slot)).Err(); err != nil {
+				log.Println("failed to delete set slot", series, slot)
+			}
+		}
+
+		if _, err = rr.client.ZRemRangeByScore(ctx, key, "-inf", upto).Result(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setSlotKey(series, slot string) string {
+	return SetCacheKeyPrefix + series + "::" + slot
+}
+
+// Series returns the tags of every series of the metric which matches the filter.
+// Metrics stored before they had series are returned as the untagged series.
+func (rr *RedisRepo) Series(ctx context.Context, metric string, filter Tags) ([]Tags, error) {
+	return rr.series(ctx, metric, filter)
+}
+
+func (rr *RedisRepo) series(ctx context.Context, metric string, filter Tags) ([]Tags, error) {
+	members, err := rr.client.SMembers(ctx, metric+SeriesCacheKeySuffix).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hasUntagged := false
+	series := []Tags{}
+
+	for _, member := range members {
+		if member == "" {
+			hasUntagged = true
+		}
+
+		tags := ParseTags(member)
+		if tags.Matches(filter) {
+			series = append(series, tags)
+		}
+	}
+
+	if !hasUntagged && len(filter) == 0 {
+		series = append(series, Tags{})
+	}
+
+	return series, nil
+}
+
+// LastWrite returns when the series of the metric matching the filter were last written,
+// the latest of them. It is the zero time when none of them were written since it is tracked.
+func (rr *RedisRepo) LastWrite(ctx context.Context, metric string, filter Tags) (time.Time, error) {
+	writes, err := rr.client.HGetAll(ctx, metric+LastWriteCacheKeySuffix).Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var last int64
+
+	for member, at := range writes {
+		if !ParseTags(member).Matches(filter) {
+			continue
+		}
+
+		micros, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			log.Println("invalid last write of", metric, member, at)
+			continue
+		}
+
+		if micros > last {
+			last = micros
+		}
+	}
+
+	if last == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.UnixMicro(last).UTC(), nil
+}
+
+// addSeries adds the series to the metric, and records it was written now.
+func (rr *RedisRepo) addSeries(ctx context.Context, metric string, tags Tags) error {
+	member := tags.String()
+
+	if err := rr.client.SAdd(ctx, metric+SeriesCacheKeySuffix, member).Err(); err != nil {
+		return err
+	}
+
+	return rr.client.HSet(ctx, metric+LastWriteCacheKeySuffix, member, utils.ToUnix(utils.Now())).Err()
+}
+
+type point struct {
+	timestamp int64
+	value     float64
+}
+
+// setValue stores the value in a hash keyed by timestamp, and
+// indexes the timestamp in a sorted set, so that ranges can be queried.
+func (rr *RedisRepo) setValue(ctx context.Context, hashKey string, key int64, value float32) error {
+	fv := fmt.Sprintf("%.3f", value)
+	// strKey := fmt.Sprintf("%d", key)
+
+	_, err := rr.client.
+		HSet(ctx, hashKey, key, fv).
+		Result()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = rr.client.
+		ZAdd(ctx, hashKey+CounterCacheKeySuffix, &redis.Z{Score: float64(key), Member: key}).
+		Result()
+
+	return err
+}
+
+// between is the score range of the timestamps from included to excluded.
+func between(from, to time.Time) *redis.ZRangeBy {
+	return &redis.ZRangeBy{
+		Min: strconv.FormatInt(utils.ToUnix(from), 10),
+		Max: "(" + strconv.FormatInt(utils.ToUnix(to), 10),
+	}
+}
+
+func (rr *RedisRepo) getValueRange(ctx context.Context, hashKey string, from, to time.Time) ([]point, error) {
+	timestamps, err := rr.client.ZRangeByScoreWithScores(ctx, hashKey+CounterCacheKeySuffix, between(from, to)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]point, 0, len(timestamps))
 
 	for _, timestamp := range timestamps {
 		member, ok := timestamp.Member.(string)
@@ -71,32 +522,35 @@ func (rr *RedisRepo) GetCountRange(ctx context.Context, metric string, interval
 			continue
 		}
 
-		val, err := rr.client.HGet(ctx, metric, member).Result()
-		if err != nil {
-			log.Println("value not set for key", metric, member, "err ", err)
+		val, err := rr.client.HGet(ctx, hashKey, member).Result()
+		if err == redis.Nil {
+			log.Println("value not set for key", hashKey, member)
 			continue
 		}
 
+		if err != nil {
+			return nil, err
+		}
+
 		if val == "" {
-			log.Println("empty count value for", metric, member)
+			log.Println("empty value for", hashKey, member)
 			continue
 		}
 
 		f, err := strconv.ParseFloat(val, 32)
 		if err != nil {
-			log.Println("failed to convert to float", metric, val)
+			log.Println("failed to convert to float", hashKey, val)
 			continue
 		}
 
 		// log.Println("metric value ", f)
-		count += f
+		points = append(points, point{timestamp: int64(timestamp.Score), value: f})
 	}
 
-	// log.Println("total count for", metric, count, " from ", len(timestamps))
-	return float32(count)
+	return points, nil
 }
 
-func (rr *RedisRepo) DeleteCountRange(ctx context.Context, metric string, interval time.Duration) error {
+func (rr *RedisRepo) deleteValueRange(ctx context.Context, hashKey string, interval time.Duration) error {
 	now := utils.Now()
 	upto := strconv.Itoa(int(utils.ToUnix(now.Add(-interval))))
 
@@ -105,7 +559,7 @@ func (rr *RedisRepo) DeleteCountRange(ctx context.Context, metric string, interv
 		Min: "-inf",
 	}
 
-	key := metric + CounterCacheKeySuffix
+	key := hashKey + CounterCacheKeySuffix
 
 	timestamps, err := rr.client.ZRangeByScoreWithScores(ctx, key, rang).Result()
 	if err != nil {
@@ -119,9 +573,9 @@ func (rr *RedisRepo) DeleteCountRange(ctx context.Context, metric string, interv
 			continue
 		}
 
-		_, err := rr.client.HDel(ctx, metric, strconv.Itoa(int(member))).Result()
+		_, err := rr.client.HDel(ctx, hashKey, strconv.Itoa(int(member))).Result()
 		if err != nil {
-			log.Println("failed to delete timestamp from hash", metric)
+			log.Println("failed to delete timestamp from hash", hashKey)
 			continue
 		}
 	}
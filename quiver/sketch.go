@@ -0,0 +1,163 @@
+package quiver
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sketch is a DDSketch, which keeps the histogram samples in logarithmic buckets.
+// Every quantile returned is within the relative accuracy of the actual value,
+// and two sketches with the same accuracy can be merged by adding the bucket counts.
+// Which makes it possible to store a sketch per time slot and merge them for a window.
+type Sketch struct {
+	gamma    float64
+	positive map[int]float64
+	negative map[int]float64
+	zero     float64
+	count    float64
+}
+
+const DefaultSketchAccuracy = 0.01
+
+const (
+	sketchPositivePrefix = "p"
+	sketchNegativePrefix = "n"
+	sketchZeroField      = "z"
+)
+
+func NewSketch(relativeAccuracy float64) *Sketch {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		relativeAccuracy = DefaultSketchAccuracy
+	}
+
+	return &Sketch{
+		gamma:    (1 + relativeAccuracy) / (1 - relativeAccuracy),
+		positive: map[int]float64{},
+		negative: map[int]float64{},
+	}
+}
+
+func (s *Sketch) index(value float64) int {
+	return int(math.Ceil(math.Log(value) / math.Log(s.gamma)))
+}
+
+func (s *Sketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+// Field returns the bucket the value falls in. It is used as the hash field
+// when the sketch is stored in redis.
+func (s *Sketch) Field(value float64) string {
+	switch {
+	case value > 0:
+		return sketchPositivePrefix + strconv.Itoa(s.index(value))
+	case value < 0:
+		return sketchNegativePrefix + strconv.Itoa(s.index(-value))
+	}
+
+	return sketchZeroField
+}
+
+func (s *Sketch) Add(value float64) {
+	s.AddField(s.Field(value), 1)
+}
+
+// AddField adds count samples to the bucket named by field, invalid fields are ignored.
+func (s *Sketch) AddField(field string, count float64) {
+	if field == sketchZeroField {
+		s.zero += count
+		s.count += count
+		return
+	}
+
+	if len(field) < 2 {
+		return
+	}
+
+	var store map[int]float64
+	switch {
+	case strings.HasPrefix(field, sketchPositivePrefix):
+		store = s.positive
+	case strings.HasPrefix(field, sketchNegativePrefix):
+		store = s.negative
+	default:
+		return
+	}
+
+	index, err := strconv.Atoi(field[1:])
+	if err != nil {
+		return
+	}
+
+	store[index] += count
+	s.count += count
+}
+
+func (s *Sketch) Merge(other *Sketch) {
+	for index, count := range other.positive {
+		s.positive[index] += count
+	}
+
+	for index, count := range other.negative {
+		s.negative[index] += count
+	}
+
+	s.zero += other.zero
+	s.count += other.count
+}
+
+func (s *Sketch) Count() float64 {
+	return s.count
+}
+
+// Quantile returns the value at quantile q, which should be between 0 and 1.
+// An empty sketch returns 0.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 || q < 0 || q > 1 {
+		return 0
+	}
+
+	rank := q * (s.count - 1)
+
+	var seen float64
+
+	// most negative values are the ones with the highest index
+	negatives := sortedIndexes(s.negative)
+	for i := len(negatives) - 1; i >= 0; i-- {
+		seen += s.negative[negatives[i]]
+		if seen > rank {
+			return -s.value(negatives[i])
+		}
+	}
+
+	seen += s.zero
+	if seen > rank {
+		return 0
+	}
+
+	positives := sortedIndexes(s.positive)
+	for _, index := range positives {
+		seen += s.positive[index]
+		if seen > rank {
+			return s.value(index)
+		}
+	}
+
+	if len(positives) == 0 {
+		return 0
+	}
+
+	return s.value(positives[len(positives)-1])
+}
+
+func sortedIndexes(store map[int]float64) []int {
+	indexes := make([]int, 0, len(store))
+	for index := range store {
+		indexes = append(indexes, index)
+	}
+
+	sort.Ints(indexes)
+	return indexes
+}
@@ -0,0 +1,117 @@
+package quiver
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// relativeError is how far the quantile of the sketch is from the actual value, relative to it.
+func relativeError(got, actual float64) float64 {
+	if actual == 0 {
+		return math.Abs(got)
+	}
+
+	return math.Abs(got-actual) / math.Abs(actual)
+}
+
+func TestSketchQuantileAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	distributions := map[string]func() float64{
+		"uniform":     func() float64 { return 1 + r.Float64()*10000 },
+		"exponential": func() float64 { return r.ExpFloat64() * 250 },
+		"lognormal":   func() float64 { return math.Exp(r.NormFloat64() * 2) },
+		"signed":      func() float64 { return r.NormFloat64() * 100 },
+	}
+
+	for name, sample := range distributions {
+		sketch := NewSketch(DefaultSketchAccuracy)
+		values := make([]float64, 10000)
+		for i := range values {
+			values[i] = sample()
+			sketch.Add(values[i])
+		}
+		sort.Float64s(values)
+
+		for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1} {
+			actual := values[int(q*float64(len(values)-1))]
+
+			if got := sketch.Quantile(q); relativeError(got, actual) > DefaultSketchAccuracy {
+				t.Errorf("%s: expected quantile %g within %g of %g, got %g", name, q, DefaultSketchAccuracy, actual, got)
+			}
+		}
+
+		if sketch.Count() != float64(len(values)) {
+			t.Errorf("%s: expected count %d, got %g", name, len(values), sketch.Count())
+		}
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	all := NewSketch(DefaultSketchAccuracy)
+	first, second := NewSketch(DefaultSketchAccuracy), NewSketch(DefaultSketchAccuracy)
+
+	for i := -500; i <= 1000; i++ {
+		all.Add(float64(i))
+		if i%2 == 0 {
+			first.Add(float64(i))
+		} else {
+			second.Add(float64(i))
+		}
+	}
+
+	first.Merge(second)
+
+	if first.Count() != all.Count() {
+		t.Fatalf("expected count %g, got %g", all.Count(), first.Count())
+	}
+
+	for _, q := range []float64{0, 0.1, 0.333, 0.5, 0.9, 1} {
+		if got, expected := first.Quantile(q), all.Quantile(q); got != expected {
+			t.Errorf("expected merged quantile %g to be %g, got %g", q, expected, got)
+		}
+	}
+}
+
+func TestSketchFields(t *testing.T) {
+	stored := NewSketch(DefaultSketchAccuracy)
+	counts := map[string]float64{}
+	for _, v := range []float64{-20, -0.5, 0, 0, 3, 42, 42} {
+		stored.Add(v)
+		counts[stored.Field(v)]++
+	}
+
+	// the sketch read back from its hash fields, like from redis
+	read := NewSketch(DefaultSketchAccuracy)
+	for field, count := range counts {
+		read.AddField(field, count)
+	}
+
+	if read.Count() != stored.Count() {
+		t.Fatalf("expected count %g, got %g", stored.Count(), read.Count())
+	}
+
+	for _, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		if got, expected := read.Quantile(q), stored.Quantile(q); got != expected {
+			t.Errorf("expected quantile %g to be %g, got %g", q, expected, got)
+		}
+	}
+}
+
+func TestSketchInvalidFields(t *testing.T) {
+	sketch := NewSketch(DefaultSketchAccuracy)
+
+	for _, field := range []string{"", "p", "n", "x12", "pabc"} {
+		sketch.AddField(field, 1)
+	}
+
+	if sketch.Count() != 0 {
+		t.Errorf("expected the invalid fields to be ignored, got count %g", sketch.Count())
+	}
+
+	if q := sketch.Quantile(0.5); q != 0 {
+		t.Errorf("expected an empty sketch to return 0, got %g", q)
+	}
+}
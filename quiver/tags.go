@@ -0,0 +1,116 @@
+package quiver
+
+import (
+	"sort"
+	"strings"
+)
+
+// Tags identify a series of a metric. Two tag sets with the same
+// keys and values are the same series, irrespective of order.
+type Tags map[string]string
+
+var (
+	// the keys and values are escaped with a backslash in the canonical form, for "," and ":"
+	// to be read back as they were. The values keep their ":", the first ":" being the separator.
+	tagKeyEscaper   = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `:`, `\:`)
+	tagValueEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`)
+)
+
+// String returns the canonical form of the tags, "key:value" pairs sorted by key and joined by ",".
+// The "," and backslashes in the keys and values, and the ":" in the keys, are escaped with a backslash.
+func (t Tags) String() string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, tagKeyEscaper.Replace(key)+":"+tagValueEscaper.Replace(t[key]))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// Matches reports whether the tags contain every key and value of the filter.
+// An empty filter matches every tag set.
+func (t Tags) Matches(filter Tags) bool {
+	for key, value := range filter {
+		if v, ok := t[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Merge returns a copy of the tags with the other tags added over it.
+func (t Tags) Merge(other Tags) Tags {
+	merged := make(Tags, len(t)+len(other))
+	for key, value := range t {
+		merged[key] = value
+	}
+
+	for key, value := range other {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// ParseTags parses tags in their canonical form. Pairs without a ":" are ignored.
+func ParseTags(canonical string) Tags {
+	tags := Tags{}
+	if canonical == "" {
+		return tags
+	}
+
+	var (
+		key, value strings.Builder
+		inValue    bool
+	)
+
+	current := &key
+
+	pair := func() {
+		if inValue {
+			tags[key.String()] = value.String()
+		}
+
+		key.Reset()
+		value.Reset()
+		inValue = false
+		current = &key
+	}
+
+	for i := 0; i < len(canonical); i++ {
+		c := canonical[i]
+
+		switch {
+		case c == '\\' && i+1 < len(canonical):
+			i++
+			current.WriteByte(canonical[i])
+		case c == ',':
+			pair()
+		case c == ':' && !inValue:
+			inValue = true
+			current = &value
+		default:
+			current.WriteByte(c)
+		}
+	}
+	pair()
+
+	return tags
+}
+
+// SeriesKey is the name the series of the metric is stored under.
+// Untagged metrics are stored under the metric name itself.
+func SeriesKey(metric string, tags Tags) string {
+	if len(tags) == 0 {
+		return metric
+	}
+
+	return metric + "{" + tags.String() + "}"
+}
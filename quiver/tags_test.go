@@ -0,0 +1,88 @@
+package quiver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagsRoundTrip(t *testing.T) {
+	tests := []struct {
+		tags      Tags
+		canonical string
+	}{
+		{Tags{}, ""},
+		{Tags{"route": "/pay"}, "route:/pay"},
+		{Tags{"route": "/pay", "method": "POST", "env": "prod"}, "env:prod,method:POST,route:/pay"},
+		{Tags{"canary": ""}, "canary:"},
+		{Tags{"url": "http://example.com:8080"}, "url:http://example.com:8080"},
+		{Tags{"route": "/a,b"}, `route:/a\,b`},
+		{Tags{"a:b": "c"}, `a\:b:c`},
+		{Tags{"path": `C:\tmp`}, `path:C:\\tmp`},
+		{Tags{"k,1": "v,1", "k2": `\,`}, `k\,1:v\,1,k2:\\\,`},
+	}
+
+	for _, tt := range tests {
+		canonical := tt.tags.String()
+		if canonical != tt.canonical {
+			t.Errorf("%v: expected %q, got %q", map[string]string(tt.tags), tt.canonical, canonical)
+		}
+
+		if parsed := ParseTags(canonical); !reflect.DeepEqual(parsed, tt.tags) {
+			t.Errorf("%q: expected %v back, got %v", canonical, map[string]string(tt.tags), map[string]string(parsed))
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		canonical string
+		tags      Tags
+	}{
+		// the keys written before the escaping read the same
+		{"route:/pay,method:GET", Tags{"route": "/pay", "method": "GET"}},
+		{"url:http://a:1", Tags{"url": "http://a:1"}},
+		// pairs without a value are ignored
+		{"route,method:GET,", Tags{"method": "GET"}},
+		// a trailing backslash escapes nothing, and is kept
+		{`trailing:\`, Tags{"trailing": `\`}},
+	}
+
+	for _, tt := range tests {
+		if parsed := ParseTags(tt.canonical); !reflect.DeepEqual(parsed, tt.tags) {
+			t.Errorf("%q: expected %v, got %v", tt.canonical, map[string]string(tt.tags), map[string]string(parsed))
+		}
+	}
+}
+
+func TestTagsMatches(t *testing.T) {
+	series := ParseTags(Tags{"route": "/a,b", "method": "GET"}.String())
+
+	tests := []struct {
+		filter  Tags
+		matches bool
+	}{
+		{nil, true},
+		{Tags{"route": "/a,b"}, true},
+		{Tags{"route": "/a,b", "method": "GET"}, true},
+		{Tags{"route": "/a"}, false},
+		{Tags{"b": ""}, false},
+		{Tags{"method": "POST"}, false},
+		{Tags{"host": ""}, false},
+	}
+
+	for _, tt := range tests {
+		if series.Matches(tt.filter) != tt.matches {
+			t.Errorf("%v: expected matches to be %v", map[string]string(tt.filter), tt.matches)
+		}
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	if key := SeriesKey("http.request", nil); key != "http.request" {
+		t.Errorf("expected the untagged series to be the metric, got %s", key)
+	}
+
+	if key := SeriesKey("http.request", Tags{"route": "/a,b"}); key != `http.request{route:/a\,b}` {
+		t.Errorf("unexpected series key %s", key)
+	}
+}